@@ -0,0 +1,288 @@
+package tmt2_go
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hand-written helpers to build and inspect the union types of the generated client. The generated unions wrap raw
+// json and accept any member type, these helpers select the member by its discriminating field.
+
+// ErrUnknownUnionMember is returned if the json of a union does not match any of its member types
+var ErrUnknownUnionMember = errors.New("unknown union member")
+
+// mustMarshal marshals union members, which only consist of strings and numbers and therefore cannot fail
+func mustMarshal(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// unionField returns the string value of a field of the union json, e.g. its mode or type
+func unionField(union json.RawMessage, field string) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(union, &fields); err != nil {
+		return "", err
+	}
+
+	var value string
+	if raw, ok := fields[field]; ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return value, nil
+}
+
+// FixedMap plays on a fixed map, which is not removed from the map pool
+func FixedMap(mapName string) IElectionStepAdd_Map {
+	return IElectionStepAdd_Map{union: mustMarshal(IFixedMap{Mode: IFixedMapModeFIXED, Fixed: mapName})}
+}
+
+// PickMap lets the team pick a map from the map pool
+func PickMap(who TWho) IElectionStepAdd_Map {
+	return IElectionStepAdd_Map{union: mustMarshal(IPickMap{Mode: IPickMapModePICK, Who: who})}
+}
+
+// RandomMap picks a random map from the map pool
+func RandomMap() IElectionStepAdd_Map {
+	return IElectionStepAdd_Map{union: mustMarshal(IAgreeOrRandomMap{Mode: IAgreeOrRandomMapModeRANDOMPICK})}
+}
+
+// AgreeMap lets both teams agree on a map from the map pool
+func AgreeMap() IElectionStepAdd_Map {
+	return IElectionStepAdd_Map{union: mustMarshal(IAgreeOrRandomMap{Mode: IAgreeOrRandomMapModeAGREE})}
+}
+
+// BanMap lets the team ban a map from the map pool
+func BanMap(who TWho) IElectionStepSkip_Map {
+	return IElectionStepSkip_Map{union: mustMarshal(IBanMap{Mode: BAN, Who: who})}
+}
+
+// RandomBanMap bans a random map from the map pool
+func RandomBanMap() IElectionStepSkip_Map {
+	return IElectionStepSkip_Map{union: mustMarshal(IRandomMapBan{Mode: RANDOMBAN})}
+}
+
+// FixedSide uses fixed starting sides
+func FixedSide(fixed TSideFixed) IElectionStepAdd_Side {
+	return IElectionStepAdd_Side{union: mustMarshal(IFixedSide{Mode: IFixedSideModeFIXED, Fixed: fixed})}
+}
+
+// PickSide lets the team choose its starting side
+func PickSide(who TWho) IElectionStepAdd_Side {
+	return IElectionStepAdd_Side{union: mustMarshal(IPickSide{Mode: IPickSideModePICK, Who: who})}
+}
+
+// KnifeSide lets the winner of a knife round choose its starting side
+func KnifeSide() IElectionStepAdd_Side {
+	return IElectionStepAdd_Side{union: mustMarshal(IRandomOrKnifeSide{Mode: IRandomOrKnifeSideModeKNIFE})}
+}
+
+// RandomSide sets random starting sides
+func RandomSide() IElectionStepAdd_Side {
+	return IElectionStepAdd_Side{union: mustMarshal(IRandomOrKnifeSide{Mode: IRandomOrKnifeSideModeRANDOM})}
+}
+
+// AddStep returns an election step which adds a map to the match maps
+func AddStep(electionMap IElectionStepAdd_Map, side IElectionStepAdd_Side) IMatchCreateDto_ElectionSteps_Item {
+	return IMatchCreateDto_ElectionSteps_Item{union: mustMarshal(IElectionStepAdd{Map: electionMap, Side: side})}
+}
+
+// SkipStep returns an election step which removes a map from the map pool
+func SkipStep(electionMap IElectionStepSkip_Map) IMatchCreateDto_ElectionSteps_Item {
+	return IMatchCreateDto_ElectionSteps_Item{union: mustMarshal(IElectionStepSkip{Map: electionMap})}
+}
+
+// electionStepValue returns the IElectionStepAdd or IElectionStepSkip of an election step union. Only add steps
+// have a side.
+func electionStepValue(union json.RawMessage) (any, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(union, &fields); err != nil {
+		return nil, err
+	}
+
+	if _, ok := fields["map"]; !ok {
+		return nil, fmt.Errorf("%w: election step without map", ErrUnknownUnionMember)
+	}
+
+	if _, ok := fields["side"]; ok {
+		var step IElectionStepAdd
+		err := json.Unmarshal(union, &step)
+		return step, err
+	}
+
+	var step IElectionStepSkip
+	err := json.Unmarshal(union, &step)
+	return step, err
+}
+
+// Value returns the IElectionStepAdd or IElectionStepSkip of the election step
+func (t IMatchCreateDto_ElectionSteps_Item) Value() (any, error) {
+	return electionStepValue(t.union)
+}
+
+// Value returns the IElectionStepAdd or IElectionStepSkip of the election step
+func (t IElectionStep) Value() (any, error) {
+	return electionStepValue(t.union)
+}
+
+// Value returns the IFixedMap, IPickMap or IAgreeOrRandomMap of the map selection
+func (t IElectionStepAdd_Map) Value() (any, error) {
+	mode, err := unionField(t.union, "mode")
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case string(IFixedMapModeFIXED):
+		return t.AsIFixedMap()
+	case string(IPickMapModePICK):
+		return t.AsIPickMap()
+	case string(IAgreeOrRandomMapModeAGREE), string(IAgreeOrRandomMapModeRANDOMPICK):
+		return t.AsIAgreeOrRandomMap()
+	default:
+		return nil, fmt.Errorf("%w: map mode %q", ErrUnknownUnionMember, mode)
+	}
+}
+
+// Value returns the IBanMap or IRandomMapBan of the map selection
+func (t IElectionStepSkip_Map) Value() (any, error) {
+	mode, err := unionField(t.union, "mode")
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case string(BAN):
+		return t.AsIBanMap()
+	case string(RANDOMBAN):
+		return t.AsIRandomMapBan()
+	default:
+		return nil, fmt.Errorf("%w: map mode %q", ErrUnknownUnionMember, mode)
+	}
+}
+
+// Value returns the IFixedSide, IPickSide or IRandomOrKnifeSide of the side selection
+func (t IElectionStepAdd_Side) Value() (any, error) {
+	mode, err := unionField(t.union, "mode")
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case string(IFixedSideModeFIXED):
+		return t.AsIFixedSide()
+	case string(IPickSideModePICK):
+		return t.AsIPickSide()
+	case string(IRandomOrKnifeSideModeKNIFE), string(IRandomOrKnifeSideModeRANDOM):
+		return t.AsIRandomOrKnifeSide()
+	default:
+		return nil, fmt.Errorf("%w: side mode %q", ErrUnknownUnionMember, mode)
+	}
+}
+
+// Type returns the type of the event, e.g. MATCH_END
+func (t Event) Type() (string, error) {
+	return unionField(t.union, "type")
+}
+
+// Value returns the concrete event struct, e.g. MatchEndEvent, selected by the type of the event
+func (t Event) Value() (any, error) {
+	eventType, err := t.Type()
+	if err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case string(ChatEventTypeCHAT):
+		return t.AsChatEvent()
+	case string(MAPELECTIONEND):
+		return t.AsElectionEndEvent()
+	case string(ROUNDEND):
+		return t.AsRoundEndEvent()
+	case string(MAPEND):
+		return t.AsMapEndEvent()
+	case string(MATCHEND):
+		return t.AsMatchEndEvent()
+	case string(KNIFEEND):
+		return t.AsKnifeRoundEndEvent()
+	case string(MAPSTART):
+		return t.AsMapStartEvent()
+	case string(LOG):
+		return t.AsLogEvent()
+	case string(ELECTIONMAPSTEP):
+		return t.AsElectionMapStep()
+	case string(ELECTIONSIDESTEP):
+		return t.AsElectionSideStep()
+	case string(MATCHCREATE):
+		return t.AsMatchCreateEvent()
+	case string(MATCHUPDATE):
+		return t.AsMatchUpdateEvent()
+	default:
+		return nil, fmt.Errorf("%w: event type %q", ErrUnknownUnionMember, eventType)
+	}
+}
+
+// ParseEvent parses a webhook payload into the concrete event struct, e.g. MatchEndEvent
+func ParseEvent(payload []byte) (any, error) {
+	var event Event
+	if err := event.UnmarshalJSON(payload); err != nil {
+		return nil, err
+	}
+	return event.Value()
+}
+
+// Value returns the ILogChat or ILogSystem of the log entry
+func (t TLogUnion) Value() (any, error) {
+	logType, err := unionField(t.union, "type")
+	if err != nil {
+		return nil, err
+	}
+
+	switch logType {
+	case string(ILogChatTypeCHAT):
+		return t.AsILogChat()
+	case string(SYSTEM):
+		return t.AsILogSystem()
+	default:
+		return nil, fmt.Errorf("%w: log type %q", ErrUnknownUnionMember, logType)
+	}
+}
+
+// Value returns the property name as string or the array index as float64 of the path item
+func (t MatchUpdateEvent_Path_Item) Value() (any, error) {
+	var value any
+	if err := json.Unmarshal(t.union, &value); err != nil {
+		return nil, err
+	}
+
+	switch value.(type) {
+	case string, float64:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("%w: path item %s", ErrUnknownUnionMember, string(t.union))
+	}
+}
+
+// PathString returns the path of the updated value joined by dots, e.g. matchMaps.0.score
+func (t MatchUpdateEvent) PathString() string {
+	parts := make([]string, 0, len(t.Path))
+	for _, item := range t.Path {
+		value, err := item.Value()
+		switch v := value.(type) {
+		case string:
+			parts = append(parts, v)
+		case float64:
+			parts = append(parts, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			parts = append(parts, fmt.Sprintf("<%v>", err))
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,243 @@
+package tmt2_go
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestElectionStepAdd_MapValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		union IElectionStepAdd_Map
+		want  any
+	}{
+		{name: "fixed", union: FixedMap("de_dust2"), want: IFixedMap{Mode: IFixedMapModeFIXED, Fixed: "de_dust2"}},
+		{name: "pick", union: PickMap(TWhoTEAMA), want: IPickMap{Mode: IPickMapModePICK, Who: TWhoTEAMA}},
+		{name: "random", union: RandomMap(), want: IAgreeOrRandomMap{Mode: IAgreeOrRandomMapModeRANDOMPICK}},
+		{name: "agree", union: AgreeMap(), want: IAgreeOrRandomMap{Mode: IAgreeOrRandomMapModeAGREE}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.union.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElectionStepSkip_MapValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		union IElectionStepSkip_Map
+		want  any
+	}{
+		{name: "ban", union: BanMap(TWhoTEAMB), want: IBanMap{Mode: BAN, Who: TWhoTEAMB}},
+		{name: "random ban", union: RandomBanMap(), want: IRandomMapBan{Mode: RANDOMBAN}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.union.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElectionStepAdd_SideValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		union IElectionStepAdd_Side
+		want  any
+	}{
+		{name: "fixed", union: FixedSide(TEAMACT), want: IFixedSide{Mode: IFixedSideModeFIXED, Fixed: TEAMACT}},
+		{name: "pick", union: PickSide(TWhoTEAMB), want: IPickSide{Mode: IPickSideModePICK, Who: TWhoTEAMB}},
+		{name: "knife", union: KnifeSide(), want: IRandomOrKnifeSide{Mode: IRandomOrKnifeSideModeKNIFE}},
+		{name: "random", union: RandomSide(), want: IRandomOrKnifeSide{Mode: IRandomOrKnifeSideModeRANDOM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.union.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElectionStepValue(t *testing.T) {
+	t.Run("add", func(t *testing.T) {
+		got, err := AddStep(PickMap(TWhoTEAMA), KnifeSide()).Value()
+		if err != nil {
+			t.Fatalf("Value() error = %v", err)
+		}
+		step, ok := got.(IElectionStepAdd)
+		if !ok {
+			t.Fatalf("Value() = %T, want IElectionStepAdd", got)
+		}
+
+		electionMap, err := step.Map.Value()
+		if err != nil || !reflect.DeepEqual(electionMap, IPickMap{Mode: IPickMapModePICK, Who: TWhoTEAMA}) {
+			t.Errorf("Map.Value() = %#v, %v", electionMap, err)
+		}
+		side, err := step.Side.Value()
+		if err != nil || !reflect.DeepEqual(side, IRandomOrKnifeSide{Mode: IRandomOrKnifeSideModeKNIFE}) {
+			t.Errorf("Side.Value() = %#v, %v", side, err)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		got, err := SkipStep(BanMap(TWhoTEAMB)).Value()
+		if err != nil {
+			t.Fatalf("Value() error = %v", err)
+		}
+		step, ok := got.(IElectionStepSkip)
+		if !ok {
+			t.Fatalf("Value() = %T, want IElectionStepSkip", got)
+		}
+
+		electionMap, err := step.Map.Value()
+		if err != nil || !reflect.DeepEqual(electionMap, IBanMap{Mode: BAN, Who: TWhoTEAMB}) {
+			t.Errorf("Map.Value() = %#v, %v", electionMap, err)
+		}
+	})
+
+	t.Run("parsed", func(t *testing.T) {
+		var step IElectionStep
+		if err := step.UnmarshalJSON([]byte(`{"map":{"mode":"FIXED","fixed":"de_nuke"},"side":{"mode":"RANDOM"}}`)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := step.Value()
+		if err != nil {
+			t.Fatalf("Value() error = %v", err)
+		}
+		if _, ok := got.(IElectionStepAdd); !ok {
+			t.Errorf("Value() = %T, want IElectionStepAdd", got)
+		}
+	})
+}
+
+func TestUnknownUnionMember(t *testing.T) {
+	var electionMap IElectionStepAdd_Map
+	if err := electionMap.UnmarshalJSON([]byte(`{"mode":"BAN","who":"TEAM_A"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var skipMap IElectionStepSkip_Map
+	if err := skipMap.UnmarshalJSON([]byte(`{"mode":"PICK","who":"TEAM_A"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var side IElectionStepAdd_Side
+	if err := side.UnmarshalJSON([]byte(`{"mode":"UNKNOWN"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var step IMatchCreateDto_ElectionSteps_Item
+	if err := step.UnmarshalJSON([]byte(`{"side":{"mode":"KNIFE"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value func() (any, error)
+	}{
+		{name: "add map", value: electionMap.Value},
+		{name: "skip map", value: skipMap.Value},
+		{name: "side", value: side.Value},
+		{name: "election step", value: step.Value},
+		{name: "event", value: func() (any, error) { return ParseEvent([]byte(`{"type":"UNKNOWN"}`)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.value(); !errors.Is(err, ErrUnknownUnionMember) {
+				t.Errorf("Value() error = %v, want ErrUnknownUnionMember", err)
+			}
+		})
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		eventType string
+		want      any
+	}{
+		{eventType: string(ChatEventTypeCHAT), want: ChatEvent{}},
+		{eventType: string(MAPELECTIONEND), want: ElectionEndEvent{}},
+		{eventType: string(ROUNDEND), want: RoundEndEvent{}},
+		{eventType: string(MAPEND), want: MapEndEvent{}},
+		{eventType: string(MATCHEND), want: MatchEndEvent{}},
+		{eventType: string(KNIFEEND), want: KnifeRoundEndEvent{}},
+		{eventType: string(MAPSTART), want: MapStartEvent{}},
+		{eventType: string(LOG), want: LogEvent{}},
+		{eventType: string(ELECTIONMAPSTEP), want: ElectionMapStep{}},
+		{eventType: string(ELECTIONSIDESTEP), want: ElectionSideStep{}},
+		{eventType: string(MATCHCREATE), want: MatchCreateEvent{}},
+		{eventType: string(MATCHUPDATE), want: MatchUpdateEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			payload := fmt.Sprintf(`{"type":%q,"matchId":"match1","timestamp":"2024-03-01T20:00:00Z"}`, tt.eventType)
+			got, err := ParseEvent([]byte(payload))
+			if err != nil {
+				t.Fatalf("ParseEvent() error = %v", err)
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Fatalf("ParseEvent() = %T, want %T", got, tt.want)
+			}
+			if matchId := reflect.ValueOf(got).FieldByName("MatchId"); matchId.IsValid() && matchId.String() != "match1" {
+				t.Errorf("ParseEvent() matchId = %q, want match1", matchId.String())
+			}
+		})
+	}
+
+	t.Run("invalid json", func(t *testing.T) {
+		if _, err := ParseEvent([]byte(`{`)); err == nil {
+			t.Error("ParseEvent() error = nil, want error")
+		}
+	})
+}
+
+func TestMatchUpdateEventPathString(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "properties and index", path: `["matchMaps",0,"score","teamA"]`, want: "matchMaps.0.score.teamA"},
+		{name: "single property", path: `["state"]`, want: "state"},
+		{name: "empty", path: `[]`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseEvent([]byte(`{"type":"MATCH_UPDATE","matchId":"match1","path":` + tt.path + `}`))
+			if err != nil {
+				t.Fatalf("ParseEvent() error = %v", err)
+			}
+			if got := event.(MatchUpdateEvent).PathString(); got != tt.want {
+				t.Errorf("PathString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown item", func(t *testing.T) {
+		event, err := ParseEvent([]byte(`{"type":"MATCH_UPDATE","matchId":"match1","path":["teamA",true]}`))
+		if err != nil {
+			t.Fatalf("ParseEvent() error = %v", err)
+		}
+		got := event.(MatchUpdateEvent).PathString()
+		if !strings.HasPrefix(got, "teamA.<") || !strings.Contains(got, ErrUnknownUnionMember.Error()) {
+			t.Errorf("PathString() = %q, want the unknown item marked", got)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// boltOpenTimeout is the time to wait for the lock of a database file held by another process
+const boltOpenTimeout = 5 * time.Second
+
+// NewBoltClient returns a database client which stores all data in a single bbolt file, for small events without
+// mongodb. The file is locked while the client is open.
+func NewBoltClient(path string) (DatabaseClient, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening database file %s: %w", path, err)
+	}
+
+	return &documentClient{store: &boltStore{db: db}}, nil
+}
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func (b *boltStore) Get(collection, key string) ([]byte, error) {
+	var document []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(collection)); bucket != nil {
+			// values are only valid during the transaction
+			document = bytes.Clone(bucket.Get([]byte(key)))
+		}
+		return nil
+	})
+	return document, err
+}
+
+func (b *boltStore) Put(collection, key string, document []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), document)
+	})
+}
+
+func (b *boltStore) Delete(collection, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(collection)); bucket != nil {
+			return bucket.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) ForEach(collection string, fn func(key string, document []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(collection))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, document []byte) error {
+			return fn(string(key), document)
+		})
+	})
+}
+
+func (b *boltStore) Ping() error {
+	return b.db.View(func(*bolt.Tx) error { return nil })
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
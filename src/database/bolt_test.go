@@ -0,0 +1,53 @@
+package database_test
+
+import (
+	"context"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database/databasetest"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltClientConformance(t *testing.T) {
+	ctx := context.Background()
+	client, err := database.NewBoltClient(filepath.Join(t.TempDir(), "tmt2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(ctx)
+
+	if err = databasetest.Conformance(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltClientReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tmt2.db")
+
+	client, err := database.NewBoltClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.CreateMatch(ctx, &database.Match{MatchID: "match1", JobState: models.JOB_STATE_IN_PROGRESS}); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err = database.NewBoltClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(ctx)
+
+	match, err := client.GetMatchByMatchID(ctx, "match1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.JobState != models.JOB_STATE_IN_PROGRESS {
+		t.Errorf("JobState = %s, want %s", match.JobState, models.JOB_STATE_IN_PROGRESS)
+	}
+}
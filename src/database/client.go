@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
 	"github.com/kamva/mgm/v3"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,6 +19,13 @@ const (
 	DefaultTimeout = 10 * time.Second
 )
 
+// Database backends selectable by DATABASE_BACKEND
+const (
+	BackendMongo  = "mongo"
+	BackendMemory = "memory"
+	BackendBolt   = "bolt"
+)
+
 // DatabaseClient is the client-interface for the main mongodb database
 type DatabaseClient interface {
 	// UpsertJob creates or updates an DotlanForumStatus entry
@@ -24,6 +34,30 @@ type DatabaseClient interface {
 	DeleteMatch(ctx context.Context, id string) error
 	GetMatchByMatchID(ctx context.Context, id string) (*Match, error)
 	List(ctx context.Context, filter interface{}) ([]*Match, error)
+	ListByJobState(ctx context.Context, states ...models.JobState) ([]*Match, error)
+	CreateRconAudit(ctx context.Context, entry *RconAudit) error
+	QuarantineMessage(ctx context.Context, entry *QuarantinedMessage) error
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// New returns the client of the database backend configured in the environment
+func New(ctx context.Context, env *environment.Environment) (DatabaseClient, error) {
+	switch env.DatabaseBackend {
+	case BackendMongo:
+		client, err := NewClient(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendMemory:
+		slog.Warn("Using the in-memory database, all matches are lost on restart")
+		return NewMemoryClient(), nil
+	case BackendBolt:
+		return NewBoltClient(env.DatabaseFile)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", env.DatabaseBackend)
+	}
 }
 
 func NewClient(ctx context.Context, env *environment.Environment) (*DatabaseClientImpl, error) {
@@ -33,8 +67,9 @@ func NewClient(ctx context.Context, env *environment.Environment) (*DatabaseClie
 		return nil, err
 	}
 
-	ctx, _ = context.WithTimeout(ctx, 10*time.Second)
-	err = client.Connect(ctx)
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = client.Connect(connectCtx)
 	if err != nil {
 		slog.Error("Error connecting to Mongo", "Error", err)
 		return nil, err
@@ -47,18 +82,24 @@ func NewClient(ctx context.Context, env *environment.Environment) (*DatabaseClie
 	}
 
 	dbClient := DatabaseClientImpl{
-		ctx:                ctx,
-		collection:         mgm.Coll(&Match{}),
-		matchExpirationTTL: env.MatchExpirationTTL,
+		ctx:                  ctx,
+		client:               client,
+		collection:           mgm.Coll(&Match{}),
+		rconAuditCollection:  mgm.Coll(&RconAudit{}),
+		quarantineCollection: mgm.Coll(&QuarantinedMessage{}),
+		matchExpirationTTL:   env.MatchExpirationTTL,
 	}
 
 	return &dbClient, err
 }
 
 type DatabaseClientImpl struct {
-	ctx                context.Context
-	collection         *mgm.Collection
-	matchExpirationTTL time.Duration
+	ctx                  context.Context
+	client               *mongo.Client
+	collection           *mgm.Collection
+	rconAuditCollection  *mgm.Collection
+	quarantineCollection *mgm.Collection
+	matchExpirationTTL   time.Duration
 }
 
 func (d DatabaseClientImpl) CreateMatch(ctx context.Context, entry *Match) (string, error) {
@@ -92,16 +133,28 @@ func (d DatabaseClientImpl) UpdateMatch(ctx context.Context, entry *Match) (stri
 }
 
 func (d DatabaseClientImpl) DeleteMatch(ctx context.Context, id string) error {
-	//TODO implement me
-	panic("implement me")
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	result, err := d.collection.DeleteOne(ctx, bson.D{{Key: "match_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
 }
 
 func (d DatabaseClientImpl) GetMatchByMatchID(ctx context.Context, id string) (*Match, error) {
 	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
 	defer cancel()
 
-	filter := bson.D{{"match_id", id}}
+	filter := bson.D{{Key: "match_id", Value: id}}
 	result := d.collection.FindOne(ctx, filter)
+	if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, result.Err())
+	}
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
@@ -143,3 +196,38 @@ func (d DatabaseClientImpl) List(ctx context.Context, filter interface{}) ([]*Ma
 
 	return jobs, nil
 }
+
+// ListByJobState returns all matches with one of the given job states, or all matches if no state is given
+func (d DatabaseClientImpl) ListByJobState(ctx context.Context, states ...models.JobState) ([]*Match, error) {
+	if len(states) == 0 {
+		return d.List(ctx, nil)
+	}
+
+	return d.List(ctx, bson.D{{Key: "jobstate", Value: bson.D{{Key: "$in", Value: states}}}})
+}
+
+func (d DatabaseClientImpl) CreateRconAudit(ctx context.Context, entry *RconAudit) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	return d.rconAuditCollection.CreateWithCtx(ctx, entry)
+}
+
+func (d DatabaseClientImpl) QuarantineMessage(ctx context.Context, entry *QuarantinedMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	return d.quarantineCollection.CreateWithCtx(ctx, entry)
+}
+
+func (d DatabaseClientImpl) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	return d.collection.Database().Client().Ping(ctx, nil)
+}
+
+// Close disconnects the client and the default client used by mgm
+func (d DatabaseClientImpl) Close(ctx context.Context) error {
+	return errors.Join(d.client.Disconnect(ctx), d.collection.Database().Client().Disconnect(ctx))
+}
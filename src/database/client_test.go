@@ -0,0 +1,31 @@
+package database_test
+
+import (
+	"context"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database/databasetest"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"os"
+	"testing"
+)
+
+// TestMongoClientConformance runs against the mongodb of MONGODB_TEST_URI, e.g. mongodb://localhost:27017
+func TestMongoClientConformance(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	env := &environment.Environment{}
+	env.MongoDbURI = uri
+	client, err := database.NewClient(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(ctx)
+
+	if err = databasetest.Conformance(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,207 @@
+// Package databasetest checks implementations of the database client
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// Conformance checks that the client behaves like the mongodb client and returns the first deviation. It creates
+// matches with random ids, which are deleted again, so it can run against a database in use.
+func Conformance(ctx context.Context, client database.DatabaseClient) error {
+	if err := client.Ping(ctx); err != nil {
+		return fmt.Errorf("Ping: %w", err)
+	}
+
+	prefix := "conformance-" + primitive.NewObjectID().Hex()
+	if _, err := client.GetMatchByMatchID(ctx, prefix+"-missing"); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("GetMatchByMatchID of a missing match: expected ErrNotFound, got %v", err)
+	}
+	if err := client.DeleteMatch(ctx, prefix+"-missing"); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("DeleteMatch of a missing match: expected ErrNotFound, got %v", err)
+	}
+
+	finishedAt := time.Now().UTC().Truncate(time.Millisecond)
+	matches := []*database.Match{
+		{MatchID: prefix + "-new", JobState: models.JOB_STATE_NEW, TMT2Backend: "a"},
+		{MatchID: prefix + "-in-progress", JobState: models.JOB_STATE_IN_PROGRESS, TMT2MatchId: "tmt2-1",
+			MatchInfo:      matchservice.MatchInfo{Id: prefix + "-in-progress"},
+			BackupRestores: []database.BackupRestore{{File: "round05.txt", RestoredBy: "admin", RestoredAt: finishedAt}},
+			TraceContext:   map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}},
+		{MatchID: prefix + "-finished", JobState: models.JOB_STATE_FINISHED, FinishedAt: &finishedAt},
+	}
+	defer func() {
+		for _, match := range matches {
+			_ = client.DeleteMatch(context.WithoutCancel(ctx), match.MatchID)
+		}
+	}()
+
+	for _, match := range matches {
+		id, err := client.CreateMatch(ctx, match)
+		if err != nil {
+			return fmt.Errorf("CreateMatch %s: %w", match.MatchID, err)
+		}
+		if match.ID.IsZero() || id != match.ID.String() {
+			return fmt.Errorf("CreateMatch %s: expected the assigned object id, got id %q and %s", match.MatchID, id, match.ID.String())
+		}
+		if match.CreatedAt.IsZero() || match.UpdatedAt.IsZero() {
+			return fmt.Errorf("CreateMatch %s: expected created_at and updated_at to be set", match.MatchID)
+		}
+	}
+
+	for _, match := range matches {
+		stored, err := client.GetMatchByMatchID(ctx, match.MatchID)
+		if err != nil {
+			return fmt.Errorf("GetMatchByMatchID %s: %w", match.MatchID, err)
+		}
+		if err = compare(match, stored); err != nil {
+			return fmt.Errorf("GetMatchByMatchID %s: %w", match.MatchID, err)
+		}
+	}
+
+	// changes of returned matches must not be visible before they are saved
+	stored, err := client.GetMatchByMatchID(ctx, matches[0].MatchID)
+	if err != nil {
+		return fmt.Errorf("GetMatchByMatchID %s: %w", matches[0].MatchID, err)
+	}
+	stored.JobState = models.JOB_STATE_ATTENTION_REQUIRED
+	if stored, err = client.GetMatchByMatchID(ctx, matches[0].MatchID); err != nil {
+		return fmt.Errorf("GetMatchByMatchID %s: %w", matches[0].MatchID, err)
+	}
+	if stored.JobState != models.JOB_STATE_NEW {
+		return fmt.Errorf("GetMatchByMatchID %s: unsaved change of a returned match is stored", matches[0].MatchID)
+	}
+
+	createdAt := matches[0].CreatedAt
+	matches[0].JobState = models.JOB_STATE_ATTENTION_REQUIRED
+	matches[0].LastError = "server not reachable"
+	matches[0].ReviveAttempts = 2
+	if _, err = client.UpdateMatch(ctx, matches[0]); err != nil {
+		return fmt.Errorf("UpdateMatch %s: %w", matches[0].MatchID, err)
+	}
+	if !matches[0].CreatedAt.Equal(createdAt) || matches[0].UpdatedAt.Before(createdAt) {
+		return fmt.Errorf("UpdateMatch %s: expected updated_at to be set and created_at to be kept", matches[0].MatchID)
+	}
+	if stored, err = client.GetMatchByMatchID(ctx, matches[0].MatchID); err != nil {
+		return fmt.Errorf("GetMatchByMatchID %s: %w", matches[0].MatchID, err)
+	}
+	if err = compare(matches[0], stored); err != nil {
+		return fmt.Errorf("UpdateMatch %s: %w", matches[0].MatchID, err)
+	}
+
+	all, err := client.List(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("List: %w", err)
+	}
+	if err = expectMatches(all, prefix, matches[0].MatchID, matches[1].MatchID, matches[2].MatchID); err != nil {
+		return fmt.Errorf("List: %w", err)
+	}
+
+	all, err = client.ListByJobState(ctx)
+	if err != nil {
+		return fmt.Errorf("ListByJobState without states: %w", err)
+	}
+	if err = expectMatches(all, prefix, matches[0].MatchID, matches[1].MatchID, matches[2].MatchID); err != nil {
+		return fmt.Errorf("ListByJobState without states: %w", err)
+	}
+
+	active, err := client.ListByJobState(ctx, models.JOB_STATE_IN_PROGRESS, models.JOB_STATE_ATTENTION_REQUIRED)
+	if err != nil {
+		return fmt.Errorf("ListByJobState: %w", err)
+	}
+	if err = expectMatches(active, prefix, matches[0].MatchID, matches[1].MatchID); err != nil {
+		return fmt.Errorf("ListByJobState: %w", err)
+	}
+
+	audit := &database.RconAudit{MatchID: matches[1].MatchID, Caller: "admin", Commands: []string{"say hi"}, Allowed: true}
+	if err = client.CreateRconAudit(ctx, audit); err != nil {
+		return fmt.Errorf("CreateRconAudit: %w", err)
+	}
+	if audit.ID.IsZero() || audit.CreatedAt.IsZero() {
+		return errors.New("CreateRconAudit: expected the object id and created_at to be set")
+	}
+
+	quarantined := &database.QuarantinedMessage{SubType: "UNKNOWN", Version: 1, Payload: "{}", Reason: "conformance"}
+	if err = client.QuarantineMessage(ctx, quarantined); err != nil {
+		return fmt.Errorf("QuarantineMessage: %w", err)
+	}
+	if quarantined.ID.IsZero() || quarantined.CreatedAt.IsZero() {
+		return errors.New("QuarantineMessage: expected the object id and created_at to be set")
+	}
+
+	if err = client.DeleteMatch(ctx, matches[2].MatchID); err != nil {
+		return fmt.Errorf("DeleteMatch %s: %w", matches[2].MatchID, err)
+	}
+	if _, err = client.GetMatchByMatchID(ctx, matches[2].MatchID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("GetMatchByMatchID of a deleted match: expected ErrNotFound, got %v", err)
+	}
+
+	return nil
+}
+
+// compare checks the fields of a stored match, timestamps are compared with the millisecond precision of mongodb
+func compare(expected, stored *database.Match) error {
+	switch {
+	case stored.ID != expected.ID:
+		return fmt.Errorf("expected id %s, got %s", expected.ID.Hex(), stored.ID.Hex())
+	case !sameTime(stored.CreatedAt, expected.CreatedAt) || !sameTime(stored.UpdatedAt, expected.UpdatedAt):
+		return fmt.Errorf("expected created_at %s and updated_at %s, got %s and %s", expected.CreatedAt, expected.UpdatedAt, stored.CreatedAt, stored.UpdatedAt)
+	case stored.JobState != expected.JobState:
+		return fmt.Errorf("expected state %s, got %s", expected.JobState, stored.JobState)
+	case stored.TMT2MatchId != expected.TMT2MatchId || stored.TMT2Backend != expected.TMT2Backend:
+		return fmt.Errorf("expected tmt2 match %s on %q, got %s on %q", expected.TMT2MatchId, expected.TMT2Backend, stored.TMT2MatchId, stored.TMT2Backend)
+	case stored.MatchInfo.Id != expected.MatchInfo.Id:
+		return fmt.Errorf("expected match info %s, got %s", expected.MatchInfo.Id, stored.MatchInfo.Id)
+	case stored.LastError != expected.LastError || stored.ReviveAttempts != expected.ReviveAttempts:
+		return fmt.Errorf("expected last error %q after %d revive attempts, got %q after %d", expected.LastError, expected.ReviveAttempts, stored.LastError, stored.ReviveAttempts)
+	case (stored.FinishedAt == nil) != (expected.FinishedAt == nil) || stored.FinishedAt != nil && !sameTime(*stored.FinishedAt, *expected.FinishedAt):
+		return fmt.Errorf("expected finished_at %v, got %v", expected.FinishedAt, stored.FinishedAt)
+	case len(stored.BackupRestores) != len(expected.BackupRestores):
+		return fmt.Errorf("expected %d backup restores, got %d", len(expected.BackupRestores), len(stored.BackupRestores))
+	case len(stored.TraceContext) != len(expected.TraceContext):
+		return fmt.Errorf("expected trace context %v, got %v", expected.TraceContext, stored.TraceContext)
+	}
+
+	for i, restore := range expected.BackupRestores {
+		if stored.BackupRestores[i].File != restore.File || !sameTime(stored.BackupRestores[i].RestoredAt, restore.RestoredAt) {
+			return fmt.Errorf("expected backup restore %v, got %v", restore, stored.BackupRestores[i])
+		}
+	}
+	for key, value := range expected.TraceContext {
+		if stored.TraceContext[key] != value {
+			return fmt.Errorf("expected trace context %v, got %v", expected.TraceContext, stored.TraceContext)
+		}
+	}
+	return nil
+}
+
+// expectMatches checks that exactly the match ids with the prefix are listed, in the given order
+func expectMatches(matches []*database.Match, prefix string, matchIds ...string) error {
+	var listed []string
+	for _, match := range matches {
+		if strings.HasPrefix(match.MatchID, prefix) {
+			listed = append(listed, match.MatchID)
+		}
+	}
+
+	if len(listed) != len(matchIds) {
+		return fmt.Errorf("expected matches %v, got %v", matchIds, listed)
+	}
+	for i := range matchIds {
+		if listed[i] != matchIds[i] {
+			return fmt.Errorf("expected matches %v in order of creation, got %v", matchIds, listed)
+		}
+	}
+	return nil
+}
+
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+)
+
+// ErrNotFound is returned if no match with the id exists
+var ErrNotFound = errors.New("match not found")
+
+// documentStore stores bson encoded documents by collection and key
+type documentStore interface {
+	// Get returns nil if the document does not exist
+	Get(collection, key string) ([]byte, error)
+	Put(collection, key string, document []byte) error
+	Delete(collection, key string) error
+	// ForEach calls fn for every document of the collection in the order of the keys. The document is only valid
+	// until fn returns.
+	ForEach(collection string, fn func(key string, document []byte) error) error
+	Ping() error
+	Close() error
+}
+
+// documentClient implements the DatabaseClient on top of a documentStore for deployments without mongodb. Documents
+// are keyed by their object id, which sorts them in the order they were created like the mongodb natural order.
+type documentClient struct {
+	store documentStore
+}
+
+var _ DatabaseClient = (*documentClient)(nil)
+
+func (d *documentClient) CreateMatch(_ context.Context, entry *Match) (string, error) {
+	err := d.create(entry)
+	return entry.ID.String(), err
+}
+
+func (d *documentClient) UpdateMatch(_ context.Context, entry *Match) (string, error) {
+	existing, err := d.store.Get(entry.CollectionName(), entry.ID.Hex())
+	if err != nil {
+		return "", err
+	}
+	if existing == nil {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, entry.MatchID)
+	}
+
+	if err = entry.Saving(); err != nil {
+		return "", err
+	}
+	return entry.ID.String(), d.put(entry.CollectionName(), entry.ID, entry)
+}
+
+func (d *documentClient) DeleteMatch(ctx context.Context, id string) error {
+	match, err := d.GetMatchByMatchID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return d.store.Delete(match.CollectionName(), match.ID.Hex())
+}
+
+func (d *documentClient) GetMatchByMatchID(_ context.Context, id string) (*Match, error) {
+	var match *Match
+	err := d.forEachMatch(func(entry *Match) bool {
+		if entry.MatchID == id {
+			match = entry
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return match, nil
+}
+
+// List returns all matches, filters are only supported by mongodb
+func (d *documentClient) List(_ context.Context, filter interface{}) ([]*Match, error) {
+	if filter != nil {
+		return nil, errors.New("filters are not supported by this database backend")
+	}
+
+	var matches []*Match
+	err := d.forEachMatch(func(entry *Match) bool {
+		matches = append(matches, entry)
+		return true
+	})
+	return matches, err
+}
+
+// ListByJobState returns all matches with one of the given job states, or all matches if no state is given
+func (d *documentClient) ListByJobState(_ context.Context, states ...models.JobState) ([]*Match, error) {
+	var matches []*Match
+	err := d.forEachMatch(func(entry *Match) bool {
+		if len(states) == 0 || slices.Contains(states, entry.JobState) {
+			matches = append(matches, entry)
+		}
+		return true
+	})
+	return matches, err
+}
+
+func (d *documentClient) CreateRconAudit(_ context.Context, entry *RconAudit) error {
+	return d.create(entry)
+}
+
+func (d *documentClient) QuarantineMessage(_ context.Context, entry *QuarantinedMessage) error {
+	return d.create(entry)
+}
+
+func (d *documentClient) Ping(_ context.Context) error {
+	return d.store.Ping()
+}
+
+func (d *documentClient) Close(_ context.Context) error {
+	return d.store.Close()
+}
+
+// storedModel is a model stored by the documentClient
+type storedModel interface {
+	mgm.Model
+	mgm.CollectionNameGetter
+	Creating() error
+	Saving() error
+}
+
+// create assigns a new object id and the timestamps like mgm does on creation
+func (d *documentClient) create(entry storedModel) error {
+	id, _ := entry.GetID().(primitive.ObjectID)
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+		entry.SetID(id)
+	}
+	if err := entry.Creating(); err != nil {
+		return err
+	}
+	if err := entry.Saving(); err != nil {
+		return err
+	}
+
+	return d.put(entry.CollectionName(), id, entry)
+}
+
+func (d *documentClient) put(collection string, id primitive.ObjectID, entry interface{}) error {
+	document, err := bson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return d.store.Put(collection, id.Hex(), document)
+}
+
+// forEachMatch decodes every match and calls fn with it until fn returns false
+func (d *documentClient) forEachMatch(fn func(entry *Match) bool) error {
+	errStop := errors.New("stop")
+	err := d.store.ForEach((&Match{}).CollectionName(), func(_ string, document []byte) error {
+		var entry Match
+		if err := bson.Unmarshal(document, &entry); err != nil {
+			return err
+		}
+		if !fn(&entry) {
+			return errStop
+		}
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
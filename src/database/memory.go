@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// NewMemoryClient returns a database client which keeps all data in memory, e.g. for tests. The data is lost on close.
+func NewMemoryClient() DatabaseClient {
+	return &documentClient{store: &memoryStore{collections: make(map[string]map[string][]byte)}}
+}
+
+type memoryStore struct {
+	mu          sync.RWMutex
+	collections map[string]map[string][]byte
+	closed      bool
+}
+
+func (m *memoryStore) Get(collection, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, errMemoryStoreClosed
+	}
+	return m.collections[collection][key], nil
+}
+
+func (m *memoryStore) Put(collection, key string, document []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return errMemoryStoreClosed
+	}
+	if m.collections[collection] == nil {
+		m.collections[collection] = make(map[string][]byte)
+	}
+	m.collections[collection][key] = document
+	return nil
+}
+
+func (m *memoryStore) Delete(collection, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return errMemoryStoreClosed
+	}
+	delete(m.collections[collection], key)
+	return nil
+}
+
+// ForEach iterates over a snapshot of the collection, so fn may modify the store
+func (m *memoryStore) ForEach(collection string, fn func(key string, document []byte) error) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return errMemoryStoreClosed
+	}
+	documents := maps.Clone(m.collections[collection])
+	m.mu.RUnlock()
+
+	keys := make([]string, 0, len(documents))
+	for key := range documents {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := fn(key, documents[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Ping() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return errMemoryStoreClosed
+	}
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.collections = nil
+	return nil
+}
+
+var errMemoryStoreClosed = errors.New("memory database is closed")
@@ -0,0 +1,14 @@
+package database_test
+
+import (
+	"context"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database/databasetest"
+	"testing"
+)
+
+func TestMemoryClientConformance(t *testing.T) {
+	if err := databasetest.Conformance(context.Background(), database.NewMemoryClient()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -14,8 +14,55 @@ type Match struct {
 	JobState         models.JobState `json:"state"`
 	FinishedAt       *time.Time      `json:"finished_at" bson:"finished_at"`
 	TMT2MatchId      string          `json:"tmt2_match_id"`
+	TMT2Backend      string          `json:"tmt2_backend" bson:"tmt2_backend"` // name of the TMT2 backend the match is placed on, empty for the first
+	TemplateName     string          `json:"template_name" bson:"template_name"`
+	LastError        string          `json:"last_error" bson:"last_error"`
+	ReviveAttempts   int             `json:"revive_attempts" bson:"revive_attempts"`
+	ReprovisionedAt  *time.Time      `json:"reprovisioned_at" bson:"reprovisioned_at"`
+	TMT2DeletedAt    *time.Time      `json:"tmt2_deleted_at" bson:"tmt2_deleted_at"` // set once the TMT2 match was deleted by the worker or through the api, so it is neither revived nor deleted again
+	BackupRestores   []BackupRestore `json:"backup_restores" bson:"backup_restores"`
+	// TraceContext is the W3C trace context of the message which created the match, so all work on it joins one trace
+	TraceContext map[string]string `json:"trace_context,omitempty" bson:"trace_context,omitempty"`
+}
+
+// BackupRestore is the audit record of a round backup restored through the api
+type BackupRestore struct {
+	File       string    `json:"file" bson:"file"`
+	RestoredBy string    `json:"restored_by" bson:"restored_by"`
+	RestoredAt time.Time `json:"restored_at" bson:"restored_at"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
 }
 
 func (*Match) CollectionName() string {
 	return "tmt2_match"
 }
+
+// RconAudit is the audit record of rcon commands sent through the api
+type RconAudit struct {
+	mgm.DefaultModel `bson:",inline"`
+	MatchID          string   `json:"match_id" bson:"match_id"`
+	TMT2MatchId      string   `json:"tmt2_match_id" bson:"tmt2_match_id"`
+	Caller           string   `json:"caller" bson:"caller"`
+	Commands         []string `json:"commands" bson:"commands"`
+	Responses        []string `json:"responses" bson:"responses"`
+	Allowed          bool     `json:"allowed" bson:"allowed"`
+	Error            string   `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+func (*RconAudit) CollectionName() string {
+	return "tmt2_rcon_audit"
+}
+
+// QuarantinedMessage is an inbound message which was rejected, stored with the reason for later inspection
+type QuarantinedMessage struct {
+	mgm.DefaultModel `bson:",inline"`
+	SubType          string `json:"subtype" bson:"subtype"`
+	Version          int    `json:"version" bson:"version"`
+	MatchID          string `json:"match_id,omitempty" bson:"match_id,omitempty"`
+	Payload          string `json:"payload" bson:"payload"`
+	Reason           string `json:"reason" bson:"reason"`
+}
+
+func (*QuarantinedMessage) CollectionName() string {
+	return "tmt2_message_quarantine"
+}
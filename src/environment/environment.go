@@ -2,12 +2,15 @@ package environment
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	environment2 "github.com/GSH-LAN/Unwindia_common/src/go/environment"
 	"github.com/GSH-LAN/Unwindia_common/src/go/logger"
 	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
 	pulsarClient "github.com/apache/pulsar-client-go/pulsar"
 	envLoader "github.com/caarlos0/env/v10"
 	"github.com/rs/zerolog/log"
+	"regexp"
 	"runtime"
 	"time"
 )
@@ -23,29 +26,80 @@ type environment struct {
 	JobsProcessInterval time.Duration `env:"JOBS_PROCESS_INTERVAL" envDefault:"10s"`
 	UseMatchServiceId   bool          `env:"USE_MATCHSERVICE_ID" envDefault:"false"`
 
-	TMT2AccessToken       string `env:"TMT2_ACCESS_TOKEN,required"`
-	TMT2URL               string `env:"TMT2_URL,required"`
+	TMT2AccessToken       string `env:"TMT2_ACCESS_TOKEN" json:"-" envDescription:"Access token of the TMT2 backend at TMT2_URL, required if TMT2_BACKENDS is not set"`
+	TMT2URL               string `env:"TMT2_URL" envDescription:"URL of the only TMT2 backend, required if TMT2_BACKENDS is not set"`
+	TMT2MaxLiveMatches    int    `env:"TMT2_MAX_LIVE_MATCHES" envDefault:"0" envDescription:"Maximum number of live matches on the TMT2 backend at TMT2_URL, 0 is unlimited"`
+	TMT2Backends          string `env:"TMT2_BACKENDS" json:"-" envDescription:"JSON list of TMT2 backends, e.g. [{\"name\":\"a\",\"url\":\"https://tmt2-a\",\"accessToken\":\"...\",\"maxLiveMatches\":8}]. New matches are placed on the least loaded healthy backend"`
 	TMT2MatchTemplateName string `env:"TMT2_MATCH_TEMPLATE_NAME" envDefault:"TMT2_MATCH"`
+	TMT2TemplateRulesName string `env:"TMT2_TEMPLATE_RULES_NAME" envDescription:"Filename of a json file in the templates directory containing rules to select the match template. The match template is used as fallback"`
+	TMT2MatchPresetName   string `env:"TMT2_MATCH_PRESET_NAME" envDescription:"Name of a TMT2 preset used as base for new matches. If set, the match template is not used"`
+
+	TMT2HealthProbeInterval    time.Duration `env:"TMT2_HEALTH_PROBE_INTERVAL" envDefault:"30s"`
+	TMT2ConnectMaxDelay        time.Duration `env:"TMT2_CONNECT_MAX_DELAY" envDefault:"1m" envDescription:"Maximum backoff between attempts to connect to TMT2 on startup"`
+	TMT2TemplateReloadInterval time.Duration `env:"TMT2_TEMPLATE_RELOAD_INTERVAL" envDefault:"30s" envDescription:"Interval to validate changed match templates. Invalid changes are rejected and the last valid version is kept"`
+	TMT2RestoreRoundBackup     bool          `env:"TMT2_RESTORE_ROUND_BACKUP" envDefault:"false" envDescription:"Restore the latest round backup when a lost TMT2 match is recreated"`
+
+	TMT2RequestTimeout      time.Duration            `env:"TMT2_REQUEST_TIMEOUT" envDefault:"10s" envDescription:"Deadline of a TMT2 operation including retries"`
+	TMT2OperationTimeouts   map[string]time.Duration `env:"TMT2_OPERATION_TIMEOUTS" envSeparator:";" envKeyValSeparator:"=" envDescription:"Semicolon separated deadlines of single TMT2 operations overriding TMT2_REQUEST_TIMEOUT, e.g. CreateMatch=30s;GetAllMatches=20s"`
+	TMT2Retries             int                      `env:"TMT2_RETRIES" envDefault:"3" envDescription:"Number of retries of idempotent TMT2 requests on connection errors and server errors"`
+	TMT2RetryBaseDelay      time.Duration            `env:"TMT2_RETRY_BASE_DELAY" envDefault:"200ms"`
+	TMT2RetryMaxDelay       time.Duration            `env:"TMT2_RETRY_MAX_DELAY" envDefault:"5s"`
+	TMT2BreakerFailures     int                      `env:"TMT2_BREAKER_FAILURES" envDefault:"5" envDescription:"Number of consecutive failed TMT2 operations which open the circuit breaker and pause the TMT2 work of the worker"`
+	TMT2BreakerOpenDuration time.Duration            `env:"TMT2_BREAKER_OPEN_DURATION" envDefault:"30s" envDescription:"Time the circuit breaker stays open before a trial request is made"`
+
+	TMT2TLSCAFile       string   `env:"TMT2_TLS_CA_FILE" envDescription:"PEM bundle of CAs trusted for the TMT2 certificate in addition to the system roots"`
+	TMT2TLSCertFile     string   `env:"TMT2_TLS_CERT_FILE" envDescription:"PEM client certificate for mTLS to TMT2"`
+	TMT2TLSKeyFile      string   `env:"TMT2_TLS_KEY_FILE" envDescription:"PEM key of the client certificate for mTLS to TMT2"`
+	TMT2TLSFingerprints []string `env:"TMT2_TLS_FINGERPRINTS" envSeparator:";" envDescription:"Semicolon separated SHA-256 fingerprints of accepted TMT2 certificates"`
+	TMT2TLSInsecure     bool     `env:"TMT2_TLS_INSECURE" envDefault:"false" envDescription:"Skip the verification of the TMT2 certificate. Only pinned fingerprints are checked"`
+
+	TMT2SyncPresets               bool   `env:"TMT2_SYNC_PRESETS" envDefault:"false" envDescription:"Create or update a TMT2 preset for every TMT2 template on startup"`
+	TMT2SyncPresetsTemplatePrefix string `env:"TMT2_SYNC_PRESETS_TEMPLATE_PREFIX" envDefault:"TMT2_"`
+
+	AdminAPITokens map[string]string `env:"ADMIN_API_TOKENS" envSeparator:";" json:"-" envDescription:"Semicolon separated callers of the admin api with their token, e.g. alice:token1;ci:token2. Callers send the token as bearer token and are recorded by name in audits. Without tokens all admin requests are rejected"`
+
+	RconAllowedCommands []string `env:"RCON_ALLOWED_COMMANDS" envSeparator:";" envDefault:"^say [\\w .,!?'()+-]{1,128}$;^mp_pause_match$;^mp_unpause_match$" envDescription:"Semicolon separated list of regular expressions for commands allowed through the rcon api. Commands containing command separators or quotes are always rejected"`
+
+	DatabaseBackend string `env:"DATABASE_BACKEND" envDefault:"mongo" envDescription:"Database backend: mongo, bolt for a single file database on small events without mongodb, or memory for tests. Data of the memory backend is lost on restart"`
+	DatabaseFile    string `env:"DATABASE_FILE" envDefault:"unwindia_tmt2.db" envDescription:"Path of the database file of the bolt backend"`
+
+	MessageTransport string `env:"MESSAGE_TRANSPORT" envDefault:"pulsar" envDescription:"Transport of messages: pulsar, or memory for local development without a broker. The memory transport enables POST /api/v1/messages to inject messages"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s" envDescription:"Maximum time to finish in-flight work on shutdown"`
+
+	TracingExporter string `env:"TRACING_EXPORTER" envDefault:"none" envDescription:"Exporter for traces: none, stdout, file or otlp. The otlp exporter is configured through the OTEL_EXPORTER_OTLP_* variables"`
+	TracingFile     string `env:"TRACING_FILE" envDefault:"traces.json" envDescription:"File the traces are appended to if the file exporter is used"`
 
 	MatchExpirationTTL  time.Duration `env:"MATCH_EXPIRATION_TTL" envDefault:"14d"`
 	MatchDeleteWaitTime time.Duration `env:"MATCH_DELETE_WAIT_TIME" envDefault:"10m"`
+	MatchReviveAttempts int           `env:"MATCH_REVIVE_ATTEMPTS" envDefault:"3" envDescription:"Number of attempts to revive an unexpectedly stopped TMT2 match before it requires operator attention"`
+}
+
+// TMT2Backend is a TMT2 instance matches can be placed on
+type TMT2Backend struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	AccessToken    string `json:"accessToken"`
+	MaxLiveMatches int    `json:"maxLiveMatches"`
 }
 
 // Environment holds all environment configuration with more advanced typing and validation
 type Environment struct {
 	environment
-	PulsarAuth pulsarClient.Authentication
+	PulsarAuth                 pulsarClient.Authentication
+	RconAllowedCommandPatterns []*regexp.Regexp
+	TMT2BackendList            []TMT2Backend
 }
 
 // Load initialized the environment variables
 func load() *Environment {
 	e := environment{}
 	if err := envLoader.Parse(&e); err != nil {
-		log.Panic().Err(err)
+		log.Panic().Err(err).Msg("Invalid environment")
 	}
 
 	if err := logger.SetLogLevel(e.LogLevel); err != nil {
-		log.Panic().Err(err)
+		log.Panic().Err(err).Msg("Invalid log level")
 	}
 
 	if e.WorkerCount <= 0 {
@@ -55,13 +109,13 @@ func load() *Environment {
 	var pulsarAuthParams = make(map[string]string)
 	if e.PulsarAuthParams != "" {
 		if err := json.Unmarshal([]byte(e.PulsarAuthParams), &pulsarAuthParams); err != nil {
-			log.Panic().Err(err)
+			log.Panic().Err(err).Msg("Invalid pulsar auth params")
 		}
 	}
 
 	var mbpulsarAuth messagebroker.PulsarAuth
 	if err := mbpulsarAuth.Unmarshal(e.PulsarAuth); err != nil {
-		log.Panic().Err(err)
+		log.Panic().Err(err).Msg("Invalid pulsar auth")
 	}
 
 	var pulsarAuth pulsarClient.Authentication
@@ -73,16 +127,74 @@ func load() *Environment {
 		pulsarAuth = pulsarClient.NewAuthenticationOAuth2(pulsarAuthParams)
 	}
 
+	var rconAllowedCommandPatterns []*regexp.Regexp
+	for _, expression := range e.RconAllowedCommands {
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			log.Panic().Err(err).Str("expression", expression).Msg("Invalid rcon allowed command pattern")
+		}
+		rconAllowedCommandPatterns = append(rconAllowedCommandPatterns, pattern)
+	}
+
+	tmt2Backends, err := parseTMT2Backends(e)
+	if err != nil {
+		log.Panic().Err(err).Msg("Invalid TMT2 backends")
+	}
+
 	e2 := Environment{
-		environment: e,
-		PulsarAuth:  pulsarAuth,
+		environment:                e,
+		PulsarAuth:                 pulsarAuth,
+		RconAllowedCommandPatterns: rconAllowedCommandPatterns,
+		TMT2BackendList:            tmt2Backends,
 	}
 
-	log.Info().Interface("environemt", e2).Msgf("Loaded Environment")
+	log.Info().Interface("environemt", e2.redacted()).Msgf("Loaded Environment")
 
 	return &e2
 }
 
+// redacted returns a copy without the access tokens of the TMT2 backends for logging. The other secrets are not
+// marshalled to json.
+func (e Environment) redacted() Environment {
+	backends := make([]TMT2Backend, 0, len(e.TMT2BackendList))
+	for _, backend := range e.TMT2BackendList {
+		backend.AccessToken = ""
+		backends = append(backends, backend)
+	}
+	e.TMT2BackendList = backends
+	return e
+}
+
+// parseTMT2Backends returns the backends of TMT2_BACKENDS, or the single backend of TMT2_URL if it is not set
+func parseTMT2Backends(e environment) ([]TMT2Backend, error) {
+	if e.TMT2Backends == "" {
+		if e.TMT2URL == "" || e.TMT2AccessToken == "" {
+			return nil, errors.New("TMT2_URL and TMT2_ACCESS_TOKEN are required if TMT2_BACKENDS is not set")
+		}
+		return []TMT2Backend{{Name: "default", URL: e.TMT2URL, AccessToken: e.TMT2AccessToken, MaxLiveMatches: e.TMT2MaxLiveMatches}}, nil
+	}
+
+	var backends []TMT2Backend
+	if err := json.Unmarshal([]byte(e.TMT2Backends), &backends); err != nil {
+		return nil, err
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("TMT2_BACKENDS is empty")
+	}
+
+	names := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		if backend.Name == "" || backend.URL == "" || backend.AccessToken == "" {
+			return nil, errors.New("name, url and accessToken are required for every TMT2 backend")
+		}
+		if names[backend.Name] {
+			return nil, fmt.Errorf("duplicate TMT2 backend %q", backend.Name)
+		}
+		names[backend.Name] = true
+	}
+	return backends, nil
+}
+
 func Get() *Environment {
 	if env == nil {
 		env = load()
@@ -0,0 +1,29 @@
+package environment
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactedHidesTMT2AccessTokens(t *testing.T) {
+	e := Environment{
+		environment: environment{
+			TMT2AccessToken: "single-secret",
+			TMT2Backends:    `[{"name":"a","url":"https://tmt2-a","accessToken":"backends-secret"}]`,
+			AdminAPITokens:  map[string]string{"alice": "admin-secret"},
+		},
+		TMT2BackendList: []TMT2Backend{{Name: "a", URL: "https://tmt2-a", AccessToken: "list-secret"}},
+	}
+
+	logged, err := json.Marshal(e.redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(logged), "secret") {
+		t.Errorf("logged environment contains a token: %s", logged)
+	}
+	if e.TMT2BackendList[0].AccessToken != "list-secret" {
+		t.Error("redacted changed the backends of the environment")
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"github.com/GSH-LAN/Unwindia_common/src/go/config"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/server"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-pulsar/pkg/pulsar"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	pulsarClient "github.com/apache/pulsar-client-go/pulsar"
 	"github.com/gammazero/workerpool"
 	"github.com/joho/godotenv"
@@ -36,6 +40,12 @@ func main() {
 
 	env := environment.Get()
 
+	shutdownTracing, err := tracing.Init(mainContext, env.TracingExporter, env.TracingFile)
+	if err != nil {
+		cancel()
+		log.Fatal().Err(err).Msg("Error initializing tracing")
+	}
+
 	var configClient config.ConfigClient
 	if env.ConfigFileName != "" {
 		configClient, err = config.NewConfigFile(mainContext, env.ConfigFileName, env.ConfigTemplatesDir)
@@ -50,37 +60,64 @@ func main() {
 
 	wp := workerpool.New(env.WorkerCount)
 
-	conn, err := pulsarClient.NewClient(pulsarClient.ClientOptions{
-		URL:            env.PulsarURL,
-		Authentication: env.PulsarAuth,
-	})
-	if err != nil {
-		panic(errors.New("cannot connect to pulsar"))
-	}
+	watermillLogger := watermill.NewStdLoggerWithOut(log.Logger, zerolog.GlobalLevel() <= zerolog.DebugLevel, zerolog.GlobalLevel() == zerolog.TraceLevel)
+
+	var matchPublisher message.Publisher
+	var memoryTransport *gochannel.GoChannel
+	switch env.MessageTransport {
+	case messagequeue.TransportMemory:
+		log.Warn().Msg("Using in-memory message transport, messages are not exchanged with other services")
+		memoryTransport = messagequeue.NewMemoryTransport(watermillLogger)
+		matchPublisher = memoryTransport
+	case messagequeue.TransportPulsar:
+		conn, err := pulsarClient.NewClient(pulsarClient.ClientOptions{
+			URL:            env.PulsarURL,
+			Authentication: env.PulsarAuth,
+		})
+		if err != nil {
+			panic(errors.New("cannot connect to pulsar"))
+		}
 
-	matchPublisher, err := pulsar.NewPublisherWithPulsarClient(
-		conn,
-		watermill.NewStdLoggerWithOut(log.Logger, zerolog.GlobalLevel() <= zerolog.DebugLevel, zerolog.GlobalLevel() == zerolog.TraceLevel),
-	)
+		matchPublisher, err = pulsar.NewPublisherWithPulsarClient(conn, watermillLogger)
+		if err != nil {
+			cancel()
+			log.Fatal().Err(err).Msg("Error creating publisher")
+		}
+	default:
+		cancel()
+		log.Fatal().Str("transport", env.MessageTransport).Msg("Unknown message transport")
+	}
 
-	srv, err := server.NewServer(mainContext, env, configClient, matchPublisher, wp)
+	srv, err := server.NewServer(mainContext, env, configClient, matchPublisher, memoryTransport, wp)
 	if err != nil {
 		cancel()
 		log.Fatal().Err(err).Msg("Error creating server")
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan error, 1)
 	go func() {
 		<-c
+		shutdownContext, shutdownCancel := context.WithTimeout(context.Background(), env.ShutdownTimeout)
+		defer shutdownCancel()
+
+		err := srv.Stop(shutdownContext)
 		cancel()
-		if err := srv.Stop(); err != nil {
-			log.Error().Err(err).Msg("Error stopping server")
+		if tracingErr := shutdownTracing(shutdownContext); tracingErr != nil {
+			log.Error().Err(tracingErr).Msg("Error flushing traces")
 		}
+		stopped <- err
 	}()
 
 	err = srv.Start()
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error starting server")
 	}
+
+	if err = <-stopped; err != nil {
+		log.Error().Err(err).Msg("Error stopping server")
+		os.Exit(1)
+	}
+	log.Info().Msg("Server stopped")
 }
@@ -0,0 +1,57 @@
+package messagequeue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+)
+
+const (
+	// SchemaVersion1 is the version of messages without an explicit version, their data is a matchservice.MatchInfo
+	SchemaVersion1 = 1
+)
+
+var ErrUnsupportedSchemaVersion = errors.New("unsupported schema version")
+
+// Envelope is the versioned envelope of inbound messages. The data is decoded according to the schema version.
+type Envelope struct {
+	Version int                        `json:"version,omitempty"`
+	Type    messagebroker.MessageTypes `json:"type"`
+	SubType string                     `json:"subtype"`
+	Data    json.RawMessage            `json:"data,omitempty"`
+}
+
+// DecodeEnvelope decodes the envelope of the payload. Messages without version are treated as SchemaVersion1.
+func DecodeEnvelope(payload []byte) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Version == 0 {
+		envelope.Version = SchemaVersion1
+	}
+
+	return &envelope, nil
+}
+
+// DecodeMatchInfo decodes the data of the envelope into a match info according to the schema version
+func (e *Envelope) DecodeMatchInfo() (*matchservice.MatchInfo, error) {
+	switch e.Version {
+	case SchemaVersion1:
+		if len(e.Data) == 0 || bytes.Equal(e.Data, []byte("null")) {
+			return nil, errors.New("message has no data")
+		}
+
+		var matchInfo matchservice.MatchInfo
+		if err := json.Unmarshal(e.Data, &matchInfo); err != nil {
+			return nil, err
+		}
+		return &matchInfo, nil
+	default:
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedSchemaVersion, e.Version)
+	}
+}
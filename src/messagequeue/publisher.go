@@ -1 +1,36 @@
 package messagequeue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// MatchAttentionRequired is published if a match cannot be handled automatically anymore
+	MatchAttentionRequired = "UNWINDIA_TMT2_MATCH_ATTENTION_REQUIRED"
+)
+
+// PublishMatchMessage publishes a message with the given subtype and match info to the topic. The trace context of ctx
+// is added to the message metadata.
+func PublishMatchMessage(ctx context.Context, publisher message.Publisher, topic, subType string, matchInfo *matchservice.MatchInfo) error {
+	payload, err := json.Marshal(messagebroker.Message{
+		Type:    messagebroker.MessageTypeUpdated,
+		SubType: subType,
+		Data:    matchInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	for key, value := range tracing.Inject(ctx) {
+		msg.Metadata.Set(key, value)
+	}
+
+	return publisher.Publish(topic, msg)
+}
@@ -3,26 +3,45 @@ package messagequeue
 import (
 	"context"
 	"encoding/json"
-	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+	"errors"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sync/atomic"
 )
 
 const (
 	SubscriberName = "UNWINDIA_TMT2"
 )
 
+// Message is a received message together with the context carrying its trace. If the envelope cannot be decoded,
+// DecodeError is set and the envelope is empty.
+type Message struct {
+	*Envelope
+	Payload     []byte
+	DecodeError error
+	Ctx         context.Context
+}
+
 type Subscriber struct {
 	mainContext    context.Context
+	receiveContext context.Context
+	stopReceiving  context.CancelFunc
+	done           chan struct{}
 	pulsarClient   pulsar.Client
 	pulsarConsumer pulsar.Consumer
+	memory         *gochannel.GoChannel // set for the in-memory transport instead of the pulsar client
 	topic          string
-	messageChan    chan<- *messagebroker.Message
+	messageChan    chan<- *Message
+	consumerClosed atomic.Bool
 }
 
-func NewSubscriber(ctx context.Context, env *environment.Environment, matchInfoChan chan *messagebroker.Message) (*Subscriber, error) {
+func NewSubscriber(ctx context.Context, env *environment.Environment, matchInfoChan chan *Message) (*Subscriber, error) {
 	client, err := pulsar.NewClient(pulsar.ClientOptions{
 		URL:            env.PulsarURL,
 		Authentication: env.PulsarAuth,
@@ -41,8 +60,13 @@ func NewSubscriber(ctx context.Context, env *environment.Environment, matchInfoC
 		return nil, err
 	}
 
+	receiveContext, stopReceiving := context.WithCancel(ctx)
+
 	subscriber := Subscriber{
 		mainContext:    ctx,
+		receiveContext: receiveContext,
+		stopReceiving:  stopReceiving,
+		done:           make(chan struct{}),
 		topic:          env.PulsarBaseTopic,
 		pulsarClient:   client,
 		pulsarConsumer: consumer,
@@ -52,36 +76,63 @@ func NewSubscriber(ctx context.Context, env *environment.Environment, matchInfoC
 	return &subscriber, nil
 }
 
+// NewMemorySubscriber creates a subscriber receiving the messages published to the in-memory transport
+func NewMemorySubscriber(ctx context.Context, env *environment.Environment, memory *gochannel.GoChannel, matchInfoChan chan *Message) *Subscriber {
+	receiveContext, stopReceiving := context.WithCancel(ctx)
+
+	return &Subscriber{
+		mainContext:    ctx,
+		receiveContext: receiveContext,
+		stopReceiving:  stopReceiving,
+		done:           make(chan struct{}),
+		topic:          env.PulsarBaseTopic,
+		memory:         memory,
+		messageChan:    matchInfoChan,
+	}
+}
+
 func (s *Subscriber) processMessages(messages <-chan *message.Message) {
+	defer close(s.done)
+
 	log := log.With().Str("topic", s.topic).Logger()
 	for msg := range messages {
-		if s.mainContext.Err() != nil {
-			return
-		}
-		msgContent := messagebroker.Message{}
-
-		err := json.Unmarshal(msg.Payload, &msgContent)
+		envelope, err := DecodeEnvelope(msg.Payload)
 		if err != nil {
 			log.Info().Interface("payload", string(msg.Payload)).Msg("Received message but error on unmarshal")
 			log.Error().Err(err).Msg("Error unmarshalling message")
-			continue
+			envelope = &Envelope{}
+		} else {
+			log.Info().Str("subtype", envelope.SubType).Int("version", envelope.Version).Msg("Received message")
 		}
-		log.Info().Interface("message", msgContent).Msgf("Received message: %+v", msgContent)
 
-		s.messageChan <- &msgContent
+		ctx, span := tracing.Tracer().Start(tracing.Extract(s.mainContext, msg.Metadata), "receive "+envelope.SubType,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", s.topic), attribute.String("messaging.message.id", msg.UUID)),
+		)
+		s.messageChan <- &Message{Envelope: envelope, Payload: msg.Payload, DecodeError: err, Ctx: ctx}
+		span.End()
 	}
 }
 
 func (s *Subscriber) StartConsumer() {
+	if s.memory != nil {
+		s.startMemoryConsumer()
+		return
+	}
+
 	messageChan := make(chan *message.Message)
 
 	go func() {
+		defer close(messageChan)
 		defer s.pulsarConsumer.Close()
+		defer s.consumerClosed.Store(true)
 
-		for s.mainContext.Err() == nil {
-			msg, err := s.pulsarConsumer.Receive(s.mainContext)
+		for s.receiveContext.Err() == nil {
+			msg, err := s.pulsarConsumer.Receive(s.receiveContext)
 			if err != nil {
-				log.Error().Err(err).Msg("Error receiving message")
+				if s.receiveContext.Err() == nil {
+					log.Error().Err(err).Msg("Error receiving message")
+				}
 				continue
 			} else {
 				response := make(map[string]interface{})
@@ -91,8 +142,9 @@ func (s *Subscriber) StartConsumer() {
 				}
 				log.Info().Msgf("[%s] Received message : %v", s.topic, response)
 				messageChan <- &message.Message{
-					UUID:    msg.Key(),
-					Payload: msg.Payload(),
+					UUID:     msg.Key(),
+					Payload:  msg.Payload(),
+					Metadata: msg.Properties(),
 				}
 			}
 
@@ -107,3 +159,75 @@ func (s *Subscriber) StartConsumer() {
 
 	log.Info().Str("topic", s.topic).Msg("Started pulsar subscriber")
 }
+
+// startMemoryConsumer passes on the messages of the in-memory transport. The transport closes the subscription when
+// receiving is stopped.
+func (s *Subscriber) startMemoryConsumer() {
+	messages, err := s.memory.Subscribe(s.receiveContext, s.topic)
+	if err != nil {
+		log.Error().Err(err).Msg("Error subscribing to in-memory transport")
+		s.consumerClosed.Store(true)
+		close(s.done)
+		return
+	}
+
+	messageChan := make(chan *message.Message)
+	go func() {
+		defer close(messageChan)
+		defer s.consumerClosed.Store(true)
+
+		for msg := range messages {
+			messageChan <- msg
+			msg.Ack()
+		}
+	}()
+
+	go s.processMessages(messageChan)
+
+	log.Info().Str("topic", s.topic).Msg("Started in-memory subscriber")
+}
+
+// Stop stops receiving messages and waits until all received messages are passed on, so no acknowledged message is
+// lost. The pulsar client stays open until Close is called.
+func (s *Subscriber) Stop(ctx context.Context) error {
+	s.stopReceiving()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the pulsar client or the in-memory transport of the subscriber
+func (s *Subscriber) Close() {
+	if s.memory != nil {
+		_ = s.memory.Close()
+		return
+	}
+	s.pulsarClient.Close()
+}
+
+// CheckHealth returns an error if the consumer is closed or the topic cannot be looked up at the broker
+func (s *Subscriber) CheckHealth(ctx context.Context) error {
+	if s.consumerClosed.Load() {
+		return errors.New("message consumer is closed")
+	}
+	if s.memory != nil {
+		return nil
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.pulsarClient.TopicPartitions(s.topic)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,17 @@
+package messagequeue
+
+import (
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+// Message transports
+const (
+	TransportPulsar = "pulsar"
+	TransportMemory = "memory" // in-process transport for local development and tests, no broker is required
+)
+
+// NewMemoryTransport creates the in-process transport. The same instance has to be used to publish and subscribe.
+func NewMemoryTransport(logger watermill.LoggerAdapter) *gochannel.GoChannel {
+	return gochannel.NewGoChannel(gochannel.Config{OutputChannelBuffer: 64}, logger)
+}
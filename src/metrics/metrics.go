@@ -0,0 +1,104 @@
+// Package metrics contains the domain specific prometheus metrics of the service
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "unwindia_tmt2"
+
+var (
+	// Jobs is the number of matches per job state
+	Jobs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs",
+		Help:      "Number of matches per job state",
+	}, []string{"state"})
+
+	// TMT2Requests counts the requests to TMT2 per operation and response status code
+	TMT2Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tmt2_requests_total",
+		Help:      "Number of requests to TMT2 per operation and status code",
+	}, []string{"operation", "status_code"})
+
+	// TMT2RequestDuration observes the latency of requests to TMT2 per operation and response status code
+	TMT2RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tmt2_request_duration_seconds",
+		Help:      "Latency of requests to TMT2 per operation and status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status_code"})
+
+	// WebhookEvents counts the received TMT2 webhook events per event type
+	WebhookEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Number of received TMT2 webhook events per type",
+	}, []string{"type"})
+
+	// Messages counts the consumed pulsar messages per subtype and processing outcome
+	Messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "Number of consumed messages per subtype and outcome",
+	}, []string{"subtype", "outcome"})
+
+	// ActiveTemplate is set to 1 for the active version of every match template
+	ActiveTemplate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_template",
+		Help:      "Active version of a match template",
+	}, []string{"template", "version"})
+
+	// TemplateReloads counts the accepted and rejected changes of match templates
+	TemplateReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "template_reloads_total",
+		Help:      "Number of accepted and rejected match template changes",
+	}, []string{"template", "result"})
+
+	// TMT2CircuitBreakerState is the state of the circuit breaker per TMT2 backend: 0 closed, 1 half-open, 2 open
+	TMT2CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tmt2_circuit_breaker_state",
+		Help:      "State of the TMT2 circuit breaker per backend: 0 closed, 1 half-open, 2 open",
+	}, []string{"backend"})
+
+	// TMT2LiveMatches is the number of live matches per TMT2 backend
+	TMT2LiveMatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tmt2_live_matches",
+		Help:      "Number of live matches per TMT2 backend",
+	}, []string{"backend"})
+
+	// WorkerTickDuration observes the duration of the worker processing all jobs
+	WorkerTickDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_tick_duration_seconds",
+		Help:      "Duration of a worker tick processing all jobs",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// WorkerTicksSkipped counts the worker ticks skipped because the previous tick was still running
+	WorkerTicksSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_ticks_skipped_total",
+		Help:      "Number of worker ticks skipped because the previous tick was still running",
+	})
+)
+
+// Template reload results
+const (
+	TemplateReloadAccepted = "accepted"
+	TemplateReloadRejected = "rejected"
+)
+
+// Message outcomes
+const (
+	MessageOutcomeProcessed   = "processed"
+	MessageOutcomeFailed      = "failed"
+	MessageOutcomeInvalid     = "invalid"
+	MessageOutcomeUnsupported = "unsupported"
+)
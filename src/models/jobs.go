@@ -11,19 +11,22 @@ const (
 	JOB_STATE_NEW JobState = iota
 	JOB_STATE_IN_PROGRESS
 	JOB_STATE_FINISHED
+	JOB_STATE_ATTENTION_REQUIRED
 	_maxEventid
 )
 
 var JobStateName = map[int]string{
 	0: "NEW",
-	1: "IN_PROGERSS",
+	1: "IN_PROGRESS",
 	2: "FINISHED",
+	3: "ATTENTION_REQUIRED",
 }
 
 var JobStateValue = map[string]JobState{
 	JobStateName[0]: JOB_STATE_NEW,
 	JobStateName[1]: JOB_STATE_IN_PROGRESS,
 	JobStateName[2]: JOB_STATE_FINISHED,
+	JobStateName[3]: JOB_STATE_ATTENTION_REQUIRED,
 }
 
 func (e JobState) String() string {
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/gin-gonic/gin"
+	"k8s.io/utils/ptr"
+	"log/slog"
+	"slices"
+)
+
+// matchAction is a named control operation on a TMT2 match, which is only possible in the given TMT2 match states
+type matchAction struct {
+	states  []tmt2_go.TMatchState
+	execute func(s *Server, ctx *gin.Context, match *database.Match) error
+}
+
+var (
+	notFinishedStates = []tmt2_go.TMatchState{tmt2_go.TMatchStateELECTION, tmt2_go.TMatchStateMATCHMAP}
+
+	matchActions = map[string]matchAction{
+		"restart_election": {
+			states:  notFinishedStates,
+			execute: updateAction(tmt2_go.IMatchUpdateDto{RestartElection: ptr.To(true)}),
+		},
+		"setup": {
+			states:  notFinishedStates,
+			execute: updateAction(tmt2_go.IMatchUpdateDto{Setup: ptr.To(true)}),
+		},
+		"init": {
+			states:  notFinishedStates,
+			execute: updateAction(tmt2_go.IMatchUpdateDto{Init: ptr.To(true)}),
+		},
+		"exec_rcon_init": {
+			states:  notFinishedStates,
+			execute: updateAction(tmt2_go.IMatchUpdateDto{ExecRconCommandsInit: ptr.To(true)}),
+		},
+		"exec_rcon_knife": {
+			states:  []tmt2_go.TMatchState{tmt2_go.TMatchStateMATCHMAP},
+			execute: updateAction(tmt2_go.IMatchUpdateDto{ExecRconCommandsKnife: ptr.To(true)}),
+		},
+		"exec_rcon_match": {
+			states:  []tmt2_go.TMatchState{tmt2_go.TMatchStateMATCHMAP},
+			execute: updateAction(tmt2_go.IMatchUpdateDto{ExecRconCommandsMatch: ptr.To(true)}),
+		},
+		"exec_rcon_end": {
+			states:  notFinishedStates,
+			execute: updateAction(tmt2_go.IMatchUpdateDto{ExecRconCommandsEnd: ptr.To(true)}),
+		},
+		"pause": {
+			states:  []tmt2_go.TMatchState{tmt2_go.TMatchStateMATCHMAP},
+			execute: rconAction("mp_pause_match"),
+		},
+		"unpause": {
+			states:  []tmt2_go.TMatchState{tmt2_go.TMatchStateMATCHMAP},
+			execute: rconAction("mp_unpause_match"),
+		},
+	}
+)
+
+func updateAction(update tmt2_go.IMatchUpdateDto) func(s *Server, ctx *gin.Context, match *database.Match) error {
+	return func(s *Server, ctx *gin.Context, match *database.Match) error {
+		tmt2Client, err := s.tmt2Pool.Client(match.TMT2Backend)
+		if err != nil {
+			return err
+		}
+		return tmt2Client.UpdateMatch(ctx.Request.Context(), match.TMT2MatchId, update)
+	}
+}
+
+func rconAction(command string) func(s *Server, ctx *gin.Context, match *database.Match) error {
+	return func(s *Server, ctx *gin.Context, match *database.Match) error {
+		_, err := s.auditedRcon(ctx, match, []string{command})
+		return err
+	}
+}
+
+// matchActionHandler executes a named control operation on the TMT2 match of a match
+func (s *Server) matchActionHandler(ctx *gin.Context) {
+	actionName := ctx.Param("action")
+	action, ok := matchActions[actionName]
+	if !ok {
+		ctx.JSON(404, gin.H{"error": fmt.Sprintf("unknown action %s", actionName)})
+		return
+	}
+
+	match, err := s.getTMT2Match(ctx)
+	if err != nil {
+		ctx.JSON(matchLookupStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	tmt2Client, err := s.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmt2Match, err := tmt2Client.GetMatchDetails(ctx.Request.Context(), match.TMT2MatchId)
+	if err != nil {
+		ctx.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = checkTMT2MatchState(tmt2Match, action.states); err != nil {
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Executing match action", "match", match.MatchID, "action", actionName, "caller", callerIdentity(ctx))
+	if err = action.execute(s, ctx, match); err != nil {
+		slog.Error("Error executing match action", "match", match.MatchID, "action", actionName, "error", err)
+		ctx.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"status": "ok"})
+}
+
+// checkTMT2MatchState returns an error if the TMT2 match is stopped or not in one of the given states
+func checkTMT2MatchState(tmt2Match *tmt2_go.IMatchResponse, states []tmt2_go.TMatchState) error {
+	if tmt2Match.IsStopped {
+		return fmt.Errorf("tmt2 match %s is stopped", tmt2Match.Id)
+	}
+
+	if !slices.Contains(states, tmt2Match.State) {
+		return fmt.Errorf("action not possible in tmt2 match state %s", tmt2Match.State)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// principalKey is the context key of the name of the authenticated admin api caller
+const principalKey = "principal"
+
+// adminAuth authenticates admin api callers by the bearer token configured in ADMIN_API_TOKENS and stores their name
+// as principal of the request
+func (s *Server) adminAuth(ctx *gin.Context) {
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if ok && token != "" {
+		for name, expected := range s.env.AdminAPITokens {
+			if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+				ctx.Set(principalKey, name)
+				ctx.Next()
+				return
+			}
+		}
+	}
+
+	ctx.AbortWithStatusJSON(401, gin.H{"error": "unauthorized"})
+}
+
+// callerIdentity returns the name of the admin api caller authenticated by adminAuth
+func callerIdentity(ctx *gin.Context) string {
+	return ctx.GetString(principalKey)
+}
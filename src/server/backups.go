@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// getBackupsHandler returns the latest round backups of a match
+func (s *Server) getBackupsHandler(ctx *gin.Context) {
+	match, err := s.getTMT2Match(ctx)
+	if err != nil {
+		ctx.JSON(matchLookupStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := strconv.Atoi(ctx.DefaultQuery("count", "0"))
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmt2Client, err := s.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	roundBackups, err := tmt2Client.GetRoundBackups(ctx.Request.Context(), match.TMT2MatchId, count)
+	if err != nil {
+		slog.Error("Error getting round backups", "match", match.MatchID, "error", err)
+		ctx.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, roundBackups)
+}
+
+// restoreBackupHandler restores a round backup of a match and records the restore on the match
+func (s *Server) restoreBackupHandler(ctx *gin.Context) {
+	s.updateMatch(ctx, func(match *database.Match) error {
+		if match.TMT2MatchId == "" {
+			return errInvalidJobState
+		}
+
+		tmt2Client, err := s.tmt2Pool.Client(match.TMT2Backend)
+		if err != nil {
+			return err
+		}
+
+		file := ctx.Param("file")
+		restoreErr := tmt2Client.LoadRoundBackup(ctx.Request.Context(), match.TMT2MatchId, file)
+
+		backupRestore := database.BackupRestore{
+			File:       file,
+			RestoredBy: callerIdentity(ctx),
+			RestoredAt: time.Now(),
+		}
+		if restoreErr != nil {
+			backupRestore.Error = restoreErr.Error()
+		}
+
+		slog.Info("Restored round backup", "match", match.MatchID, "backupRestore", backupRestore)
+
+		match.BackupRestores = append(match.BackupRestores, backupRestore)
+		if _, err := s.dbClient.UpdateMatch(ctx.Request.Context(), match); err != nil {
+			return errors.Join(restoreErr, err)
+		}
+
+		return restoreErr
+	})
+}
+
+var errNoTMT2Match = errors.New("match has no tmt2 match")
+
+// getTMT2Match returns the match of the id parameter, if it has a TMT2 match
+func (s *Server) getTMT2Match(ctx *gin.Context) (*database.Match, error) {
+	match, err := s.dbClient.GetMatchByMatchID(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if match.TMT2MatchId == "" {
+		return nil, errNoTMT2Match
+	}
+
+	return match, nil
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+const readinessCheckTimeout = 5 * time.Second
+
+type dependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthzHandler reports the service is alive
+func (s *Server) healthzHandler(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{"status": "ok"})
+}
+
+// readyzHandler checks all dependencies the service needs to process matches and reports the status of each of them.
+// The service keeps consuming messages and storing jobs while single TMT2 backends are unavailable, so they only
+// degrade readiness. Backends which did not connect yet are reported as connecting with the error of their last attempt,
+// which also only degrades readiness, e.g. while TMT2 is still booting. Once all TMT2 backends failed after connecting,
+// no match can be processed and the service is unavailable.
+func (s *Server) readyzHandler(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	databaseCheck := "mongodb"
+	if s.env.DatabaseBackend != database.BackendMongo {
+		databaseCheck = "database/" + s.env.DatabaseBackend
+	}
+	messagesCheck := "pulsar"
+	if s.env.MessageTransport != messagequeue.TransportPulsar {
+		messagesCheck = "messages/" + s.env.MessageTransport
+	}
+	checks := map[string]func(ctx context.Context) error{
+		databaseCheck: s.dbClient.Ping,
+		messagesCheck: s.subscriber.CheckHealth,
+		"templates": func(context.Context) error {
+			return s.tmt2Pool.Default().TemplatesReady()
+		},
+	}
+	degradingChecks := make(map[string]bool)
+	for name, tmt2Client := range s.tmt2Pool.Clients() {
+		checks["tmt2/"+name] = checkTMT2(tmt2Client)
+		degradingChecks["tmt2/"+name] = true
+	}
+
+	status := 200
+	overallStatus := "ok"
+	failedBackends := 0
+	connectingBackends := 0
+	dependencies := make(map[string]dependencyStatus, len(checks))
+	for name, check := range checks {
+		if err := check(checkCtx); err != nil {
+			if degradingChecks[name] {
+				failedBackends++
+				if overallStatus == "ok" {
+					overallStatus = "degraded"
+				}
+			} else {
+				status = 503
+				overallStatus = "unavailable"
+			}
+			dependencyState := "error"
+			if errors.Is(err, tmt2.ErrNotConnected) {
+				dependencyState = "connecting"
+				connectingBackends++
+			}
+			dependencies[name] = dependencyStatus{Status: dependencyState, Error: err.Error()}
+			continue
+		}
+		dependencies[name] = dependencyStatus{Status: "ok"}
+	}
+
+	if failedBackends == len(degradingChecks) && connectingBackends == 0 {
+		status = 503
+		overallStatus = "unavailable"
+	}
+
+	ctx.JSON(status, gin.H{"status": overallStatus, "dependencies": dependencies, "tmt2Backends": s.tmt2Pool.Status()})
+}
+
+// checkTMT2 returns a check which reports the last connection error and, once the client is connected, the result of
+// the last health probe. It does not send requests itself, so readiness checks neither wait for retries nor count
+// towards the circuit breaker.
+func checkTMT2(tmt2Client *tmt2.TMT2ClientImpl) func(ctx context.Context) error {
+	return func(context.Context) error {
+		if err := tmt2Client.ConnectionError(); err != nil {
+			return err
+		}
+		if !tmt2Client.Available() {
+			return tmt2.ErrCircuitOpen
+		}
+		if !tmt2Client.Healthy() {
+			if err := tmt2Client.ProbeError(); err != nil {
+				return err
+			}
+			return errors.New("tmt2 health probe failed")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"errors"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"time"
+)
+
+// listMatchesHandler returns all matches, optionally filtered by one or more state query parameters
+func (s *Server) listMatchesHandler(ctx *gin.Context) {
+	var states []models.JobState
+	for _, stateName := range ctx.QueryArray("state") {
+		var state models.JobState
+		if err := state.UnmarshalJSON([]byte(stateName)); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		states = append(states, state)
+	}
+
+	matches, err := s.dbClient.ListByJobState(ctx.Request.Context(), states...)
+	if err != nil {
+		slog.Error("Error listing matches", "error", err)
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]matchResponse, 0, len(matches))
+	for _, match := range matches {
+		response = append(response, newMatchResponse(match))
+	}
+
+	ctx.JSON(200, response)
+}
+
+// getMatchHandler returns a single match
+func (s *Server) getMatchHandler(ctx *gin.Context) {
+	match, err := s.dbClient.GetMatchByMatchID(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(matchLookupStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, newMatchResponse(match))
+}
+
+// retryMatchHandler immediately retries the creation of the TMT2 match of a new match
+func (s *Server) retryMatchHandler(ctx *gin.Context) {
+	s.updateMatch(ctx, func(match *database.Match) error {
+		if match.JobState != models.JOB_STATE_NEW {
+			return errInvalidJobState
+		}
+		matches, err := s.dbClient.List(ctx.Request.Context(), nil)
+		if err != nil {
+			return err
+		}
+		return s.worker.processMatch(ctx.Request.Context(), match, s.worker.liveMatches(matches))
+	})
+}
+
+// finishMatchHandler marks a match as finished, so its TMT2 match gets deleted by the worker
+func (s *Server) finishMatchHandler(ctx *gin.Context) {
+	s.updateMatch(ctx, func(match *database.Match) error {
+		now := time.Now()
+		match.JobState = models.JOB_STATE_FINISHED
+		match.FinishedAt = &now
+		_, err := s.dbClient.UpdateMatch(ctx.Request.Context(), match)
+		return err
+	})
+}
+
+// resetMatchHandler resets a match to new, so the worker creates a new TMT2 match. An existing live TMT2 match with
+// the same passthrough is reused by the worker.
+func (s *Server) resetMatchHandler(ctx *gin.Context) {
+	s.updateMatch(ctx, func(match *database.Match) error {
+		match.JobState = models.JOB_STATE_NEW
+		match.TMT2MatchId = ""
+		match.TemplateName = ""
+		match.LastError = ""
+		match.ReviveAttempts = 0
+		match.FinishedAt = nil
+		match.TMT2DeletedAt = nil
+		_, err := s.dbClient.UpdateMatch(ctx.Request.Context(), match)
+		return err
+	})
+}
+
+// deleteTMT2MatchHandler deletes the TMT2 match of a match without changing the job state. The deleted TMT2 match is
+// not revived by the worker until the match is reset.
+func (s *Server) deleteTMT2MatchHandler(ctx *gin.Context) {
+	s.updateMatch(ctx, func(match *database.Match) error {
+		if match.TMT2MatchId == "" {
+			return errInvalidJobState
+		}
+		if err := s.worker.deleteTMT2Match(ctx.Request.Context(), match); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		match.TMT2DeletedAt = &now
+		_, err := s.dbClient.UpdateMatch(ctx.Request.Context(), match)
+		return err
+	})
+}
+
+var errInvalidJobState = errors.New("operation is not possible in current job state")
+
+// matchLookupStatus returns the http status of an error getting a match, only missing matches are not found
+func matchLookupStatus(err error) int {
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, errNoTMT2Match) {
+		return 404
+	}
+	return 500
+}
+
+// updateMatch applies the update to the match of the id parameter while holding the work item lock of the match and
+// responds with the updated match
+func (s *Server) updateMatch(ctx *gin.Context, update func(match *database.Match) error) {
+	matchID := ctx.Param("id")
+	match, err := s.worker.withMatchLock(ctx.Request.Context(), matchID, update)
+	switch {
+	case errors.Is(err, ErrMatchLocked):
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	case match == nil:
+		status := matchLookupStatus(err)
+		if status == 500 {
+			slog.Error("Error getting match", "match", matchID, "error", err)
+		}
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errInvalidJobState):
+		ctx.JSON(409, gin.H{"error": err.Error(), "match": newMatchResponse(match)})
+		return
+	case err != nil:
+		slog.Error("Error updating match", "match", matchID, "error", err)
+		ctx.JSON(502, gin.H{"error": err.Error(), "match": newMatchResponse(match)})
+		return
+	}
+
+	slog.Info("Updated match through api", "match", matchID, "caller", callerIdentity(ctx), "path", ctx.FullPath())
+	ctx.JSON(200, newMatchResponse(match))
+}
+
+// matchResponse is a match returned by the admin api. It has the keys of the stored match, but not the passwords of
+// the game server.
+type matchResponse struct {
+	ID              primitive.ObjectID       `json:"_id"`
+	CreatedAt       time.Time                `json:"created_at"`
+	UpdatedAt       time.Time                `json:"updated_at"`
+	MatchID         string                   `json:"match_id"`
+	MatchInfo       matchInfoResponse        `json:"MatchInfo"`
+	JobState        models.JobState          `json:"state"`
+	FinishedAt      *time.Time               `json:"finished_at"`
+	TMT2MatchId     string                   `json:"tmt2_match_id"`
+	TMT2Backend     string                   `json:"tmt2_backend"`
+	TemplateName    string                   `json:"template_name"`
+	LastError       string                   `json:"last_error"`
+	ReviveAttempts  int                      `json:"revive_attempts"`
+	ReprovisionedAt *time.Time               `json:"reprovisioned_at"`
+	TMT2DeletedAt   *time.Time               `json:"tmt2_deleted_at"`
+	BackupRestores  []database.BackupRestore `json:"backup_restores"`
+}
+
+// matchInfoResponse is the match info without ServerPassword, ServerPasswordMgmt and ServerTvPassword
+type matchInfoResponse struct {
+	Id              string
+	MsID            string
+	Team1           matchservice.Team
+	Team2           matchservice.Team
+	PlayerAmount    uint
+	Game            string
+	Map             string
+	ServerAddress   string
+	ServerTvAddress string
+	TournamentName  string
+	MatchTitle      string
+	MapList         []string
+	NumberOfMaps    int
+	Ready           bool
+	Finished        bool
+}
+
+func newMatchResponse(match *database.Match) matchResponse {
+	info := match.MatchInfo
+	return matchResponse{
+		ID:        match.ID,
+		CreatedAt: match.CreatedAt,
+		UpdatedAt: match.UpdatedAt,
+		MatchID:   match.MatchID,
+		MatchInfo: matchInfoResponse{
+			Id:              info.Id,
+			MsID:            info.MsID,
+			Team1:           info.Team1,
+			Team2:           info.Team2,
+			PlayerAmount:    info.PlayerAmount,
+			Game:            info.Game,
+			Map:             info.Map,
+			ServerAddress:   info.ServerAddress,
+			ServerTvAddress: info.ServerTvAddress,
+			TournamentName:  info.TournamentName,
+			MatchTitle:      info.MatchTitle,
+			MapList:         info.MapList,
+			NumberOfMaps:    info.NumberOfMaps,
+			Ready:           info.Ready,
+			Finished:        info.Finished,
+		},
+		JobState:        match.JobState,
+		FinishedAt:      match.FinishedAt,
+		TMT2MatchId:     match.TMT2MatchId,
+		TMT2Backend:     match.TMT2Backend,
+		TemplateName:    match.TemplateName,
+		LastError:       match.LastError,
+		ReviveAttempts:  match.ReviveAttempts,
+		ReprovisionedAt: match.ReprovisionedAt,
+		TMT2DeletedAt:   match.TMT2DeletedAt,
+		BackupRestores:  match.BackupRestores,
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"strings"
+)
+
+// injectableSubTypes are the subtypes which can be injected, also by their short name without UNWINDIA_MATCH_ prefix
+var injectableSubTypes = []string{
+	messagebroker.UNWINDIA_MATCH_SERVER_READY.String(),
+	messagebroker.UNWINDIA_MATCH_FINISHED.String(),
+}
+
+type injectMessageRequest struct {
+	SubType   string                  `json:"subtype"`
+	MatchInfo *matchservice.MatchInfo `json:"matchInfo"`
+}
+
+// injectMessageHandler publishes a message to the in-memory transport, so the full flow can be used without a broker
+// during local development
+func (s *Server) injectMessageHandler(ctx *gin.Context) {
+	var request injectMessageRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.MatchInfo == nil {
+		ctx.JSON(400, gin.H{"error": "matchInfo is required"})
+		return
+	}
+
+	subType := ""
+	for _, injectable := range injectableSubTypes {
+		if request.SubType == injectable || request.SubType == strings.TrimPrefix(injectable, "UNWINDIA_MATCH_") {
+			subType = injectable
+		}
+	}
+	if subType == "" {
+		ctx.JSON(400, gin.H{"error": "subtype must be one of " + strings.Join(injectableSubTypes, ", ")})
+		return
+	}
+
+	if err := messagequeue.PublishMatchMessage(ctx.Request.Context(), s.matchPublisher, s.env.PulsarBaseTopic, subType, request.MatchInfo); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Injected message", "subtype", subType, "match", request.MatchInfo.Id)
+	ctx.JSON(202, gin.H{"status": "published", "subtype": subType})
+}
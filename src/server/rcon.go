@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"strings"
+)
+
+type rconRequest struct {
+	Commands []string `json:"commands" binding:"required,min=1"`
+}
+
+// rconHandler sends allowed rcon commands to the game server of a match and records every call in the rcon audit
+func (s *Server) rconHandler(ctx *gin.Context) {
+	var request rconRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	match, err := s.getTMT2Match(ctx)
+	if err != nil {
+		ctx.JSON(matchLookupStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = s.checkRconCommands(request.Commands); err != nil {
+		s.createRconAudit(ctx, &database.RconAudit{
+			MatchID:     match.MatchID,
+			TMT2MatchId: match.TMT2MatchId,
+			Caller:      callerIdentity(ctx),
+			Commands:    request.Commands,
+			Allowed:     false,
+			Error:       err.Error(),
+		})
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses, err := s.auditedRcon(ctx, match, request.Commands)
+	if err != nil {
+		ctx.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"responses": responses})
+}
+
+// auditedRcon sends the rcon commands to the game server of a match and records the call in the rcon audit
+func (s *Server) auditedRcon(ctx *gin.Context, match *database.Match, commands []string) ([]string, error) {
+	tmt2Client, err := s.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := tmt2Client.Rcon(ctx.Request.Context(), match.TMT2MatchId, commands)
+
+	audit := database.RconAudit{
+		MatchID:     match.MatchID,
+		TMT2MatchId: match.TMT2MatchId,
+		Caller:      callerIdentity(ctx),
+		Commands:    commands,
+		Responses:   responses,
+		Allowed:     true,
+	}
+	if err != nil {
+		slog.Error("Error sending rcon commands", "match", match.MatchID, "error", err)
+		audit.Error = err.Error()
+	}
+	s.createRconAudit(ctx, &audit)
+
+	return responses, err
+}
+
+func (s *Server) createRconAudit(ctx *gin.Context, audit *database.RconAudit) {
+	slog.Info("Rcon commands through api", "audit", *audit)
+	if err := s.dbClient.CreateRconAudit(ctx.Request.Context(), audit); err != nil {
+		slog.Error("Error creating rcon audit", "match", audit.MatchID, "error", err)
+	}
+}
+
+// rconSeparators are the characters which separate or quote console commands, so a command containing them could
+// chain further commands behind an allowed one
+const rconSeparators = ";\n\r\""
+
+// checkRconCommands returns an error if one of the commands contains a command separator or does not match any allowed
+// rcon command pattern
+func (s *Server) checkRconCommands(commands []string) error {
+	var errs []error
+	for _, command := range commands {
+		if strings.ContainsAny(command, rconSeparators) {
+			errs = append(errs, fmt.Errorf("command %q contains a command separator or quote", command))
+			continue
+		}
+
+		allowed := false
+		for _, pattern := range s.env.RconAllowedCommandPatterns {
+			if pattern.MatchString(command) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Errorf("command %q is not allowed", command))
+		}
+	}
+
+	return errors.Join(errs...)
+}
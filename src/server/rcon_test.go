@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRconAllowedCommands are the default RCON_ALLOWED_COMMANDS
+var testRconAllowedCommands = []*regexp.Regexp{
+	regexp.MustCompile(`^say [\w .,!?'()+-]{1,128}$`),
+	regexp.MustCompile(`^mp_pause_match$`),
+	regexp.MustCompile(`^mp_unpause_match$`),
+}
+
+func TestCheckRconCommands(t *testing.T) {
+	s := &Server{env: &environment.Environment{RconAllowedCommandPatterns: testRconAllowedCommands}}
+
+	tests := []struct {
+		name     string
+		commands []string
+		allowed  bool
+	}{
+		{name: "say", commands: []string{"say Good luck, have fun!"}, allowed: true},
+		{name: "pause and unpause", commands: []string{"mp_pause_match", "mp_unpause_match"}, allowed: true},
+		{name: "not allowed", commands: []string{"sv_cheats 1"}},
+		{name: "one of several not allowed", commands: []string{"mp_pause_match", "quit"}},
+		{name: "allowed prefix", commands: []string{"mp_pause_match_now"}},
+		{name: "empty say", commands: []string{"say "}},
+		{name: "too long say", commands: []string{"say " + strings.Repeat("a", 129)}},
+		{name: "semicolon", commands: []string{"say hi; rcon_password x"}},
+		{name: "newline", commands: []string{"say hi\nquit"}},
+		{name: "carriage return", commands: []string{"say hi\rquit"}},
+		{name: "quote", commands: []string{`say "hi";quit`}},
+		{name: "quote only", commands: []string{`say "hi"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.checkRconCommands(tt.commands); (err == nil) != tt.allowed {
+				t.Errorf("checkRconCommands(%q) error = %v, want allowed %t", tt.commands, err, tt.allowed)
+			}
+		})
+	}
+}
+
+// auditRecorder records the rcon audits created in the database
+type auditRecorder struct {
+	database.DatabaseClient
+	mu     sync.Mutex
+	audits []database.RconAudit
+}
+
+func (r *auditRecorder) CreateRconAudit(ctx context.Context, entry *database.RconAudit) error {
+	r.mu.Lock()
+	r.audits = append(r.audits, *entry)
+	r.mu.Unlock()
+	return r.DatabaseClient.CreateRconAudit(ctx, entry)
+}
+
+func TestRconHandler(t *testing.T) {
+	wt := newWorkerTest(t, 1, false)
+	match := wt.createMatch(t, "match1")
+
+	recorder := &auditRecorder{DatabaseClient: wt.db}
+	wt.server.dbClient = recorder
+	wt.server.env.RconAllowedCommandPatterns = testRconAllowedCommands
+	wt.server.env.AdminAPITokens = map[string]string{"alice": "alice-token"}
+	router := gin.New()
+	router.POST("/matches/:id/rcon", wt.server.adminAuth, wt.server.rconHandler)
+
+	tests := []struct {
+		name       string
+		matchID    string
+		token      string
+		commands   []string
+		wantStatus int
+		wantSent   []string
+		wantAudit  *database.RconAudit
+	}{
+		{name: "unauthenticated", matchID: match.MatchID, commands: []string{"mp_pause_match"}, wantStatus: 401},
+		{name: "wrong token", matchID: match.MatchID, token: "other", commands: []string{"mp_pause_match"}, wantStatus: 401},
+		{name: "unknown match", matchID: "unknown", token: "alice-token", commands: []string{"mp_pause_match"}, wantStatus: 404},
+		{name: "no commands", matchID: match.MatchID, token: "alice-token", commands: []string{}, wantStatus: 400},
+		{
+			name: "allowed", matchID: match.MatchID, token: "alice-token", commands: []string{"say hi", "mp_pause_match"},
+			wantStatus: 200, wantSent: []string{"say hi", "mp_pause_match"},
+			wantAudit: &database.RconAudit{MatchID: match.MatchID, TMT2MatchId: match.TMT2MatchId, Caller: "alice", Commands: []string{"say hi", "mp_pause_match"}, Allowed: true},
+		},
+		{
+			name: "chained", matchID: match.MatchID, token: "alice-token", commands: []string{"say hi;quit"},
+			wantStatus: 403,
+			wantAudit:  &database.RconAudit{MatchID: match.MatchID, TMT2MatchId: match.TMT2MatchId, Caller: "alice", Commands: []string{"say hi;quit"}, Allowed: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sentBefore := wt.fake.RconCommands(match.TMT2MatchId)
+			recorder.audits = nil
+
+			body, _ := json.Marshal(rconRequest{Commands: tt.commands})
+			request := httptest.NewRequest(http.MethodPost, "/matches/"+tt.matchID+"/rcon", bytes.NewReader(body))
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if sent := wt.fake.RconCommands(match.TMT2MatchId)[len(sentBefore):]; !slices.Equal(sent, tt.wantSent) {
+				t.Errorf("sent commands = %q, want %q", sent, tt.wantSent)
+			}
+
+			if tt.wantAudit == nil {
+				if len(recorder.audits) != 0 {
+					t.Errorf("audits = %+v, want none", recorder.audits)
+				}
+				return
+			}
+			if len(recorder.audits) != 1 {
+				t.Fatalf("audits = %+v, want one", recorder.audits)
+			}
+			audit := recorder.audits[0]
+			if audit.MatchID != tt.wantAudit.MatchID || audit.TMT2MatchId != tt.wantAudit.TMT2MatchId || audit.Caller != tt.wantAudit.Caller ||
+				!slices.Equal(audit.Commands, tt.wantAudit.Commands) || audit.Allowed != tt.wantAudit.Allowed {
+				t.Errorf("audit = %+v, want %+v", audit, *tt.wantAudit)
+			}
+			if audit.Allowed && (audit.Error != "" || len(audit.Responses) != len(tt.commands)) {
+				t.Errorf("audit error = %q, responses = %q", audit.Error, audit.Responses)
+			}
+			if !audit.Allowed && audit.Error == "" {
+				t.Error("audit of rejected commands has no error")
+			}
+		})
+	}
+}
@@ -1,27 +1,38 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/GSH-LAN/Unwindia_common/src/go/config"
 	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
 	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
-	"github.com/GSH-LAN/Unwindia_common/src/go/template"
 	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/router"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/gammazero/workerpool"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"net/http"
 	"sync"
+	"time"
+)
+
+const (
+	matchLockTimeout       = 30 * time.Second
+	matchLockRetryInterval = 100 * time.Millisecond
 )
 
 type Server struct {
@@ -32,34 +43,90 @@ type Server struct {
 	workerpool     *workerpool.WorkerPool
 	subscriber     *messagequeue.Subscriber
 	matchPublisher message.Publisher
-	messageChan    chan *messagebroker.Message
+	messageChan    chan *messagequeue.Message
 	lock           sync.Mutex
 	router         *gin.Engine
+	httpServer     *http.Server
+	tmt2Pool       *tmt2.Pool
+	worker         *Worker
 	stop           chan struct{}
 }
 
-func NewServer(ctx context.Context, env *environment.Environment, cfgClient config.ConfigClient, matchPublisher message.Publisher, wp *workerpool.WorkerPool) (*Server, error) {
-	messageChan := make(chan *messagebroker.Message)
+// NewServer creates the server. If memoryTransport is set, messages are received from it instead of pulsar.
+func NewServer(ctx context.Context, env *environment.Environment, cfgClient config.ConfigClient, matchPublisher message.Publisher, memoryTransport *gochannel.GoChannel, wp *workerpool.WorkerPool) (*Server, error) {
+	messageChan := make(chan *messagequeue.Message)
+
+	var subscriber *messagequeue.Subscriber
+	var err error
+	if memoryTransport != nil {
+		subscriber = messagequeue.NewMemorySubscriber(ctx, env, memoryTransport, messageChan)
+	} else {
+		subscriber, err = messagequeue.NewSubscriber(ctx, env, messageChan)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	subscriber, err := messagequeue.NewSubscriber(ctx, env, messageChan)
+	db, err := database.New(ctx, env)
 	if err != nil {
 		return nil, err
 	}
 
-	db, err := database.NewClient(ctx, env)
-	if err != nil {
-		return nil, err
+	backends := make([]tmt2.Backend, 0, len(env.TMT2BackendList))
+	for _, backend := range env.TMT2BackendList {
+		backends = append(backends, tmt2.Backend{Name: backend.Name, URL: backend.URL, AccessToken: backend.AccessToken, MaxLiveMatches: backend.MaxLiveMatches})
 	}
 
-	tmt2Client, err := tmt2.NewTMT2Client(cfgClient, env.TMT2URL, env.TMT2AccessToken, env.TMT2MatchTemplateName)
+	tmt2Pool, err := tmt2.NewPool(cfgClient, backends, env.TMT2MatchTemplateName, env.TMT2MatchPresetName, env.TMT2TemplateRulesName, tmt2.ResilienceConfig{
+		RequestTimeout:      env.TMT2RequestTimeout,
+		OperationTimeouts:   env.TMT2OperationTimeouts,
+		Retries:             env.TMT2Retries,
+		RetryBaseDelay:      env.TMT2RetryBaseDelay,
+		RetryMaxDelay:       env.TMT2RetryMaxDelay,
+		BreakerFailures:     env.TMT2BreakerFailures,
+		BreakerOpenDuration: env.TMT2BreakerOpenDuration,
+	}, tmt2.TLSConfig{
+		CAFile:       env.TMT2TLSCAFile,
+		CertFile:     env.TMT2TLSCertFile,
+		KeyFile:      env.TMT2TLSKeyFile,
+		Fingerprints: env.TMT2TLSFingerprints,
+		Insecure:     env.TMT2TLSInsecure,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	worker := NewWorker(ctx, wp, db, matchPublisher, cfgClient, env.PulsarBaseTopic, tmt2Pool, env.MatchDeleteWaitTime, env.MatchReviveAttempts, env.TMT2RestoreRoundBackup)
 	go func() {
-		_ = NewWorker(ctx, wp, db, matchPublisher, cfgClient, env.PulsarBaseTopic, tmt2Client, env.MatchDeleteWaitTime).StartWorker(env.JobsProcessInterval)
+		_ = worker.StartWorker(env.JobsProcessInterval)
 	}()
 
+	go tmt2Pool.Default().StartTemplateReload(ctx, env.TMT2TemplateReloadInterval)
+
+	// messages are consumed and jobs stored while TMT2 is unavailable, the worker starts processing them once connected
+	for _, tmt2Client := range tmt2Pool.Clients() {
+		go func(tmt2Client *tmt2.TMT2ClientImpl) {
+			if err := tmt2Client.Connect(ctx, env.TMT2ConnectMaxDelay); err != nil {
+				return
+			}
+
+			if env.TMT2SyncPresets {
+				if err := tmt2Client.SyncPresets(ctx, env.TMT2SyncPresetsTemplatePrefix); err != nil {
+					slog.Error("Error syncing templates to tmt2 presets", "error", err)
+				}
+			}
+
+			go worker.process()
+
+			// TMT2 may have lost its matches while it was unavailable, so all jobs are checked immediately after recovery
+			tmt2Client.StartHealthProbe(ctx, env.TMT2HealthProbeInterval, func() {
+				go worker.process()
+			})
+		}(tmt2Client)
+	}
+
+	ginRouter := router.DefaultRouter()
+
 	srv := Server{
 		ctx:            ctx,
 		env:            env,
@@ -70,7 +137,10 @@ func NewServer(ctx context.Context, env *environment.Environment, cfgClient conf
 		messageChan:    messageChan,
 		lock:           sync.Mutex{},
 		stop:           make(chan struct{}),
-		router:         router.DefaultRouter(),
+		router:         ginRouter,
+		httpServer:     &http.Server{Addr: fmt.Sprintf(":%d", env.HTTPPort), Handler: ginRouter},
+		tmt2Pool:       tmt2Pool,
+		worker:         worker,
 		matchPublisher: matchPublisher,
 	}
 	return &srv, nil
@@ -79,7 +149,9 @@ func NewServer(ctx context.Context, env *environment.Environment, cfgClient conf
 func (s *Server) Start() error {
 	s.setupRouter()
 	go func() {
-		_ = s.router.Run(fmt.Sprintf(":%d", s.env.HTTPPort))
+		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error running http server", "error", err)
+		}
 	}()
 
 	s.subscriber.StartConsumer()
@@ -96,47 +168,106 @@ func (s *Server) Start() error {
 	}
 }
 
-func (s *Server) Stop() error {
+// Stop shuts the server down in order: intake of messages and requests is stopped, in-flight handlers and the running
+// worker tick are finished, then the publisher, the pulsar client and the database connection are closed. Work which is
+// not finished until ctx is done is abandoned and the error is returned.
+func (s *Server) Stop(ctx context.Context) error {
 	slog.Info("Stopping server")
+
+	var errs []error
+	if err := s.subscriber.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping subscriber: %w", err))
+	}
 	close(s.stop)
-	return fmt.Errorf("server Stopped")
-}
 
-func (s *Server) messageHandler(message *messagebroker.Message) {
-	slog.Info("Received message", "message", message)
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping http server: %w", err))
+	}
 
-	bytes, err := json.Marshal(message.Data)
-	if err != nil {
-		slog.Error("Error decoding match", "error", err)
-		return
+	if err := s.worker.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping worker: %w", err))
+	}
 
+	if err := stopWorkerpool(ctx, s.workerpool); err != nil {
+		errs = append(errs, fmt.Errorf("draining workerpool: %w", err))
 	}
 
-	var match matchservice.MatchInfo
-	err = json.Unmarshal(bytes, &match)
-	if err != nil {
-		slog.Error("Error decoding match", "error", err)
-		return
+	if err := s.matchPublisher.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing publisher: %w", err))
+	}
+	s.subscriber.Close()
 
+	if err := s.dbClient.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("closing database: %w", err))
 	}
 
-	slog.Info("Received match", "match", match)
+	slog.Info("Stopped server")
+	return errors.Join(errs...)
+}
+
+// stopWorkerpool waits until all submitted tasks of the workerpool are finished
+func stopWorkerpool(ctx context.Context, wp *workerpool.WorkerPool) error {
+	stopped := make(chan struct{})
+	go func() {
+		wp.StopWait()
+		close(stopped)
+	}()
 
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) messageHandler(message *messagequeue.Message) {
+	slog.Info("Received message", "subtype", message.SubType, "version", message.Version)
+	ctx, span := tracing.Tracer().Start(message.Ctx, "process "+message.SubType, trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	if message.DecodeError != nil {
+		s.rejectMessage(ctx, message, nil, message.DecodeError)
+		return
+	}
+
+	var handle func(context.Context, *matchservice.MatchInfo) error
 	switch message.SubType {
 	case messagebroker.UNWINDIA_MATCH_SERVER_READY.String():
-		err = s.handleServerReadyMessage(&match)
+		handle = s.handleServerReadyMessage
 	case messagebroker.UNWINDIA_MATCH_FINISHED.String():
-		err = s.handleMatchFinishedMessage(&match)
-
+		handle = s.handleMatchFinishedMessage
+	default:
+		metrics.Messages.WithLabelValues(message.SubType, metrics.MessageOutcomeUnsupported).Inc()
+		return
 	}
 
+	match, err := message.DecodeMatchInfo()
 	if err != nil {
-		slog.Error("Error processing message", "error", err, "message", *message)
+		s.rejectMessage(ctx, message, nil, err)
+		return
+	}
+
+	if err = s.validateMatchInfo(message.SubType, match); err != nil {
+		s.rejectMessage(ctx, message, match, err)
+		return
+	}
+
+	slog.Info("Received match", "match", match)
+
+	if err = handle(ctx, match); err != nil {
+		slog.Error("Error processing message", "error", err, "subtype", message.SubType)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.Messages.WithLabelValues(message.SubType, metrics.MessageOutcomeFailed).Inc()
+		return
 	}
+
+	metrics.Messages.WithLabelValues(message.SubType, metrics.MessageOutcomeProcessed).Inc()
 }
 
 // handle server ready message
-func (s *Server) handleServerReadyMessage(match *matchservice.MatchInfo) error {
+func (s *Server) handleServerReadyMessage(ctx context.Context, match *matchservice.MatchInfo) error {
 	// create server for match
 	slog.Info("Match server is ready, saving Match to db", "id", match.Id)
 	matchId := match.Id
@@ -145,19 +276,20 @@ func (s *Server) handleServerReadyMessage(match *matchservice.MatchInfo) error {
 	}
 
 	// check if we already have a match with this id
-	_, err := s.dbClient.GetMatchByMatchID(s.ctx, matchId)
+	_, err := s.dbClient.GetMatchByMatchID(ctx, matchId)
 	if err == nil {
 		slog.Info("Match already exists in db", "id", match.Id)
 		return nil
 	}
 
 	dbMatch := database.Match{
-		MatchInfo: *match,
-		MatchID:   matchId,
-		JobState:  models.JOB_STATE_NEW,
+		MatchInfo:    *match,
+		MatchID:      matchId,
+		JobState:     models.JOB_STATE_NEW,
+		TraceContext: tracing.Inject(ctx),
 	}
 
-	objectId, err := s.dbClient.CreateMatch(s.ctx, &dbMatch)
+	objectId, err := s.dbClient.CreateMatch(ctx, &dbMatch)
 	if err != nil {
 		// TODO: some retry stuff we need :(
 		slog.Error("Error creating job for match", "error", err)
@@ -168,7 +300,7 @@ func (s *Server) handleServerReadyMessage(match *matchservice.MatchInfo) error {
 }
 
 // handle match finished message
-func (s *Server) handleMatchFinishedMessage(match *matchservice.MatchInfo) error {
+func (s *Server) handleMatchFinishedMessage(ctx context.Context, match *matchservice.MatchInfo) error {
 	// update match entry to finished and set timestamp, so it gets removed after configured time
 	slog.Info("Match is finished, updating db", "id", match.Id)
 	matchId := match.Id
@@ -176,14 +308,12 @@ func (s *Server) handleMatchFinishedMessage(match *matchservice.MatchInfo) error
 		matchId = match.MsID
 	}
 
-	dbMatch, err := s.dbClient.GetMatchByMatchID(s.ctx, matchId)
-	if err != nil {
-		slog.Error("Error getting match from db", "error", err)
+	// the worker may be changing the match, which would overwrite the finished state with its stale copy
+	err := s.waitForMatchLock(ctx, matchId, func(dbMatch *database.Match) error {
+		dbMatch.JobState = models.JOB_STATE_FINISHED
+		_, err := s.dbClient.UpdateMatch(ctx, dbMatch)
 		return err
-	}
-
-	dbMatch.JobState = models.JOB_STATE_FINISHED
-	_, err = s.dbClient.UpdateMatch(s.ctx, dbMatch)
+	})
 	if err != nil {
 		slog.Error("Error updating match in db", "error", err)
 		return err
@@ -195,17 +325,45 @@ func (s *Server) handleMatchFinishedMessage(match *matchservice.MatchInfo) error
 func (s *Server) setupRouter() {
 	internal := s.router.Group("/api/internal")
 	internal.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	internal.GET("/healthz", s.healthzHandler)
+	internal.GET("/readyz", s.readyzHandler)
 
 	v1Api := s.router.Group("/api/v1")
 	v1Api.POST("/webhook/:id", s.webhookHandler)
 	v1Api.POST("/test_template", s.testTemplateHandler)
+
+	if len(s.env.AdminAPITokens) == 0 {
+		slog.Warn("ADMIN_API_TOKENS is not set, all requests to the admin api are rejected")
+	}
+	admin := v1Api.Group("/matches", s.adminAuth)
+	admin.GET("", s.listMatchesHandler)
+	admin.GET("/:id", s.getMatchHandler)
+	admin.POST("/:id/retry", s.retryMatchHandler)
+	admin.POST("/:id/finish", s.finishMatchHandler)
+	admin.POST("/:id/reset", s.resetMatchHandler)
+	admin.DELETE("/:id/tmt2", s.deleteTMT2MatchHandler)
+	admin.POST("/:id/rcon", s.rconHandler)
+	admin.POST("/:id/actions/:action", s.matchActionHandler)
+	admin.GET("/:id/backups", s.getBackupsHandler)
+	admin.POST("/:id/backups/:file/restore", s.restoreBackupHandler)
+
+	if s.env.MessageTransport == messagequeue.TransportMemory {
+		v1Api.POST("/messages", s.injectMessageHandler)
+	}
+}
+
+// webhookEvent contains the fields all TMT2 webhook events have in common
+type webhookEvent struct {
+	Type             string  `json:"type"`
+	MatchId          string  `json:"matchId"`
+	MatchPassthrough *string `json:"matchPassthrough"`
 }
 
 func (s *Server) webhookHandler(ctx *gin.Context) {
 	body := ctx.Request.Body
 	defer body.Close()
 
-	var webhookPayload interface{}
+	var webhookPayload webhookEvent
 
 	err := json.NewDecoder(body).Decode(&webhookPayload)
 	if err != nil {
@@ -215,59 +373,57 @@ func (s *Server) webhookHandler(ctx *gin.Context) {
 	}
 
 	slog.Info("Received webhook payload", "webhookPayload", webhookPayload)
-	ctx.JSON(200, gin.H{"status": "ok"})
-}
+	metrics.WebhookEvents.WithLabelValues(webhookPayload.Type).Inc()
 
-// testTemplateHandler uses the payload as string and tries to parse it with the match template
-func (s *Server) testTemplateHandler(ctx *gin.Context) {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(ctx.Request.Body)
-	templateTextToTest := buf.String()
-
-	testMatch := matchservice.MatchInfo{
-		Id:   "test",
-		MsID: "abc123",
-		Team1: matchservice.Team{
-			Id:    "def456",
-			Name:  "Team1",
-			Ready: true,
-		},
-		Team2: matchservice.Team{
-			Id:    "ghi789",
-			Name:  "Team2",
-			Ready: true,
-		},
-		PlayerAmount:       4,
-		Game:               "cs2",
-		Map:                "de_dust2",
-		ServerAddress:      "127.0.0.1:27015",
-		ServerPassword:     "password",
-		ServerPasswordMgmt: "rootpassword",
-		ServerTvAddress:    "",
-		ServerTvPassword:   "",
-		TournamentName:     "nicematch",
-		MatchTitle:         "Team1 vs Team2",
-		Ready:              true,
+	matchId := ctx.Param("id")
+	if webhookPayload.MatchPassthrough != nil && *webhookPayload.MatchPassthrough != "" {
+		matchId = *webhookPayload.MatchPassthrough
 	}
 
-	parsedTmt2MatchTemplate, err := template.ParseTemplateForMatch(templateTextToTest, &testMatch)
-	if err != nil {
-		slog.Error("Error parsing template", "error", err)
-		ctx.JSON(400, gin.H{"error": err.Error()})
-		return
+	if webhookPayload.Type == string(tmt2_go.MATCHEND) {
+		if err = s.handleMatchEndEvent(ctx.Request.Context(), matchId); err != nil {
+			slog.Error("Error handling match end event", "id", matchId, "error", err)
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	slog.Debug("Parsed template", "parsedTmt2MatchTemplate", parsedTmt2MatchTemplate)
+	ctx.JSON(200, gin.H{"status": "ok"})
+}
 
-	// try to bind parsed template to tmt2 match
+// handleMatchEndEvent sets the finish timestamp of the match, so the worker finishes the job after the delete wait time
+func (s *Server) handleMatchEndEvent(ctx context.Context, matchId string) error {
+	return s.waitForMatchLock(ctx, matchId, func(match *database.Match) (err error) {
+		ctx, span := startMatchSpan(ctx, match, "webhook "+string(tmt2_go.MATCHEND))
+		defer func() { endSpan(span, err) }()
 
-	var createMatchDto = tmt2_go.IMatchCreateDto{}
-	err = json.Unmarshal([]byte(parsedTmt2MatchTemplate), &createMatchDto)
-	if err != nil {
-		slog.Error("Error unmarshalling parsed template", "error", err)
-		ctx.JSON(400, gin.H{"error": err.Error()})
-		return
-	}
+		if match.FinishedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		match.FinishedAt = &now
+		// once the lock is held the end is stored, even if TMT2 gave up on the request meanwhile
+		_, err = s.dbClient.UpdateMatch(context.WithoutCancel(ctx), match)
+		return err
+	})
+}
+
+// waitForMatchLock runs fn with the match read while holding its lock. The worker or the api only hold the lock while
+// they change the match, so it waits for the lock until the context is done or matchLockTimeout is reached.
+func (s *Server) waitForMatchLock(ctx context.Context, matchId string, fn func(match *database.Match) error) error {
+	ctx, cancel := context.WithTimeout(ctx, matchLockTimeout)
+	defer cancel()
 
-	ctx.JSON(200, createMatchDto)
+	for {
+		_, err := s.worker.withMatchLock(ctx, matchId, fn)
+		if !errors.Is(err, ErrMatchLocked) {
+			return err
+		}
+
+		select {
+		case <-time.After(matchLockRetryInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		}
+	}
 }
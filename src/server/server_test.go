@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"testing"
+	"time"
+)
+
+func TestHandleMatchFinishedMessageWaitsForLock(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryClient()
+	worker := NewWorker(ctx, nil, db, nil, nil, "test", nil, 0, 1, false)
+	srv := &Server{ctx: ctx, env: &environment.Environment{}, dbClient: db, worker: worker}
+
+	if _, err := db.CreateMatch(ctx, &database.Match{MatchID: "match1", JobState: models.JOB_STATE_IN_PROGRESS}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the worker holds the lock and writes its copy of the running match before releasing it
+	if err := worker.lock.Lock(ctx, "match1", nil); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := db.GetMatchByMatchID(ctx, "match1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- srv.handleMatchFinishedMessage(ctx, &matchservice.MatchInfo{Id: "match1"}) }()
+
+	time.Sleep(2 * matchLockRetryInterval)
+	stale.ReviveAttempts++
+	if _, err = db.UpdateMatch(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	worker.lock.Unlock(ctx, "match1")
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	match := getMatch(t, db, "match1")
+	if match.JobState != models.JOB_STATE_FINISHED || match.ReviveAttempts != 1 {
+		t.Errorf("state = %s, revive attempts = %d, want finished after the worker's update", match.JobState, match.ReviveAttempts)
+	}
+}
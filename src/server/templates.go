@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+)
+
+// testTemplateRequestContentType is the content type of a testTemplateRequest. Other payloads, including plain
+// application/json, are template texts like before the structured request existed.
+const testTemplateRequestContentType = "application/vnd.unwindia.test-template+json"
+
+// testTemplateRequest is the structured request of the test template endpoint. Either a template text or the name of a
+// configured template or spec is required, the match info defaults to the sample match info. If spec is set, the
+// template text is parsed as match spec.
+type testTemplateRequest struct {
+	Template     string                  `json:"template"`
+	Spec         bool                    `json:"spec"`
+	TemplateName string                  `json:"templateName"`
+	MatchInfo    *matchservice.MatchInfo `json:"matchInfo"`
+}
+
+// testTemplateHandler renders a template and validates the result as TMT2 match. For requests with the
+// testTemplateRequestContentType see testTemplateRequest, any other payload is used as template text and rendered
+// with the sample match info.
+func (s *Server) testTemplateHandler(ctx *gin.Context) {
+	var request testTemplateRequest
+	if ctx.ContentType() == testTemplateRequestContentType {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(ctx.Request.Body)
+		request.Template = buf.String()
+	}
+
+	templateToTest := tmt2.MatchTemplateSource{Text: request.Template, Spec: request.Spec}
+	if request.TemplateName != "" {
+		source, ok := s.tmt2Pool.Default().MatchTemplate(request.TemplateName)
+		if !ok {
+			ctx.JSON(404, gin.H{"error": "template " + request.TemplateName + " not found"})
+			return
+		}
+		templateToTest = source
+	}
+
+	if templateToTest.Text == "" {
+		ctx.JSON(400, gin.H{"error": "template or templateName is required"})
+		return
+	}
+
+	testMatch := tmt2.SampleMatchInfo
+	if request.MatchInfo != nil {
+		testMatch = *request.MatchInfo
+	}
+
+	createMatchDto, templateErrors := templateToTest.Render(testMatch.Id, &testMatch)
+	if len(templateErrors) > 0 {
+		slog.Debug("Invalid template", "errors", templateErrors)
+		ctx.JSON(400, gin.H{"error": templateErrors[0].Error(), "errors": templateErrors})
+		return
+	}
+
+	slog.Debug("Parsed template", "createMatchDto", string(createMatchDto))
+
+	ctx.JSON(200, createMatchDto)
+}
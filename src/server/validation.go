@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// validateMatchInfo checks that the match info contains all fields required to handle a message of the subtype
+func (s *Server) validateMatchInfo(subType string, match *matchservice.MatchInfo) error {
+	var errs []error
+	if s.env.UseMatchServiceId && match.MsID == "" {
+		errs = append(errs, errors.New("MsID is required"))
+	}
+	if !s.env.UseMatchServiceId && match.Id == "" {
+		errs = append(errs, errors.New("Id is required"))
+	}
+
+	if subType == messagebroker.UNWINDIA_MATCH_SERVER_READY.String() {
+		if match.Team1.Name == "" {
+			errs = append(errs, errors.New("Team1.Name is required"))
+		}
+		if match.Team2.Name == "" {
+			errs = append(errs, errors.New("Team2.Name is required"))
+		}
+		if match.ServerAddress == "" {
+			errs = append(errs, errors.New("ServerAddress is required"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// rejectMessage stores the message with the reason in the quarantine collection instead of processing it
+func (s *Server) rejectMessage(ctx context.Context, message *messagequeue.Message, match *matchservice.MatchInfo, reason error) {
+	slog.Warn("Rejected message", "subtype", message.SubType, "version", message.Version, "reason", reason)
+	metrics.Messages.WithLabelValues(message.SubType, metrics.MessageOutcomeInvalid).Inc()
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(reason)
+	span.SetStatus(codes.Error, reason.Error())
+
+	quarantinedMessage := database.QuarantinedMessage{
+		SubType: message.SubType,
+		Version: message.Version,
+		Payload: string(message.Payload),
+		Reason:  reason.Error(),
+	}
+	if match != nil {
+		quarantinedMessage.MatchID = match.Id
+		if s.env.UseMatchServiceId {
+			quarantinedMessage.MatchID = match.MsID
+		}
+	}
+
+	if err := s.dbClient.QuarantineMessage(ctx, &quarantinedMessage); err != nil {
+		slog.Error("Error storing rejected message in quarantine", "error", err, "payload", quarantinedMessage.Payload)
+	}
+}
@@ -7,79 +7,122 @@ import (
 	"github.com/GSH-LAN/Unwindia_common/src/go/workitemLock"
 	"github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
 	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gammazero/workerpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 )
 
+const (
+	backupRestoreWorker = "worker"
+	// roundBackupSearchCount is the number of latest round backups on the game server searched for one of a lost match
+	roundBackupSearchCount = 20
+)
+
+var ErrMatchLocked = errors.New("match is currently locked")
+
 type Worker struct {
-	ctx            context.Context
-	workerpool     *workerpool.WorkerPool
-	dbClient       database.DatabaseClient
-	matchPublisher message.Publisher
-	semaphore      *semaphore.Weighted
-	lock           workitemLock.WorkItemLock
-	config         config.ConfigClient
-	baseTopic      string
-	tmt2Client     *tmt2.TMT2ClientImpl
-	deleteWaitTime time.Duration
-}
-
-func NewWorker(ctx context.Context, pool *workerpool.WorkerPool, db database.DatabaseClient, matchPublisher message.Publisher, config config.ConfigClient, baseTopic string, tmt2Client *tmt2.TMT2ClientImpl, deleteWaitTime time.Duration) *Worker {
+	ctx                context.Context
+	workerpool         *workerpool.WorkerPool
+	dbClient           database.DatabaseClient
+	matchPublisher     message.Publisher
+	semaphore          *semaphore.Weighted
+	lock               workitemLock.WorkItemLock
+	config             config.ConfigClient
+	baseTopic          string
+	tmt2Pool           *tmt2.Pool
+	deleteWaitTime     time.Duration
+	reviveAttempts     int
+	restoreRoundBackup bool
+	stop               chan struct{}
+}
+
+func NewWorker(ctx context.Context, pool *workerpool.WorkerPool, db database.DatabaseClient, matchPublisher message.Publisher, config config.ConfigClient, baseTopic string, tmt2Pool *tmt2.Pool, deleteWaitTime time.Duration, reviveAttempts int, restoreRoundBackup bool) *Worker {
 	w := Worker{
-		ctx:            ctx,
-		workerpool:     pool,
-		dbClient:       db,
-		matchPublisher: matchPublisher,
-		semaphore:      semaphore.NewWeighted(int64(1)),
-		lock:           workitemLock.NewMemoryWorkItemLock(),
-		config:         config,
-		baseTopic:      baseTopic,
-		tmt2Client:     tmt2Client,
-		deleteWaitTime: deleteWaitTime,
+		ctx:                ctx,
+		workerpool:         pool,
+		dbClient:           db,
+		matchPublisher:     matchPublisher,
+		semaphore:          semaphore.NewWeighted(int64(1)),
+		lock:               workitemLock.NewMemoryWorkItemLock(),
+		config:             config,
+		baseTopic:          baseTopic,
+		tmt2Pool:           tmt2Pool,
+		deleteWaitTime:     deleteWaitTime,
+		reviveAttempts:     reviveAttempts,
+		restoreRoundBackup: restoreRoundBackup,
+		stop:               make(chan struct{}),
 	}
 	return &w
 }
 
 func (w *Worker) StartWorker(interval time.Duration) error {
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			go w.process()
+		case <-w.stop:
+			return nil
 		case <-w.ctx.Done():
 			return w.ctx.Err()
 		}
 	}
 }
 
+// Stop stops the ticker and waits until a running tick is finished. Afterwards no tick is processed anymore.
+func (w *Worker) Stop(ctx context.Context) error {
+	close(w.stop)
+	return w.semaphore.Acquire(ctx, 1)
+}
+
 // process is the ticker routine that finds jobs which are ready to be processed
 func (w *Worker) process() {
 	slog.Debug("start processing")
 
 	if !w.semaphore.TryAcquire(1) {
 		slog.Warn("Skip processing, semaphore already acquired")
+		metrics.WorkerTicksSkipped.Inc()
 		return
 	}
 	defer w.semaphore.Release(1)
 
+	start := time.Now()
+	defer func() { metrics.WorkerTickDuration.Observe(time.Since(start).Seconds()) }()
+
 	matches, err := w.dbClient.List(w.ctx, nil)
 	if err != nil {
 		slog.Error("error retrieving new jobs from database", "Error", err)
 		return
 	}
 
+	updateJobMetrics(matches)
+	liveMatches := w.liveMatches(matches)
+
 	for _, match := range matches {
-		if err = w.lock.Lock(w.ctx, match.MatchID, nil); err != nil {
+		if !w.processable(match) {
+			slog.Debug("Skip processing, TMT2 backend is not connected or the circuit breaker is open", "Match", match.MatchID, "Backend", w.tmt2Pool.Name(match.TMT2Backend))
 			continue
 		}
-		defer w.lock.Unlock(w.ctx, match.MatchID)
-		err = w.processMatch(w.ctx, match)
-		if err != nil {
+		if _, err = w.withMatchLock(w.ctx, match.MatchID, func(match *database.Match) error {
+			// the match may have changed since it was listed
+			if !w.processable(match) {
+				return nil
+			}
+			return w.processMatch(w.ctx, match, liveMatches)
+		}); err != nil && !errors.Is(err, ErrMatchLocked) {
 			slog.Error("error processing job", "Error", err)
 		}
 	}
@@ -87,20 +130,121 @@ func (w *Worker) process() {
 	slog.Debug("finished job processing")
 }
 
-func (w *Worker) processMatch(ctx context.Context, match *database.Match) error {
+// processable reports whether the TMT2 backend of the match is available. Matches which are not placed yet are placed
+// on an available backend.
+func (w *Worker) processable(match *database.Match) bool {
+	return (match.JobState == models.JOB_STATE_NEW && match.TMT2Backend == "") || w.tmt2Pool.Available(match.TMT2Backend)
+}
+
+// liveMatches returns the number of matches per TMT2 backend which are placed and not finished yet
+func (w *Worker) liveMatches(matches []*database.Match) map[string]int {
+	liveMatches := make(map[string]int)
+	for _, name := range w.tmt2Pool.Names() {
+		liveMatches[name] = 0
+	}
+
+	for _, match := range matches {
+		switch match.JobState {
+		case models.JOB_STATE_NEW:
+			if match.TMT2Backend != "" {
+				liveMatches[w.tmt2Pool.Name(match.TMT2Backend)]++
+			}
+		case models.JOB_STATE_IN_PROGRESS, models.JOB_STATE_ATTENTION_REQUIRED:
+			liveMatches[w.tmt2Pool.Name(match.TMT2Backend)]++
+		}
+	}
+
+	for name, count := range liveMatches {
+		metrics.TMT2LiveMatches.WithLabelValues(name).Set(float64(count))
+	}
+	return liveMatches
+}
+
+// updateJobMetrics sets the number of matches per job state, states without matches are reported as zero
+func updateJobMetrics(matches []*database.Match) {
+	jobs := make(map[string]float64)
+	for _, stateName := range models.JobStateName {
+		jobs[stateName] = 0
+	}
+	for _, match := range matches {
+		jobs[match.JobState.String()]++
+	}
+	for stateName, count := range jobs {
+		metrics.Jobs.WithLabelValues(stateName).Set(count)
+	}
+}
+
+// withMatchLock loads the match with the given id while holding its work item lock and passes it to fn, so the api does
+// not update a match concurrently with the worker
+func (w *Worker) withMatchLock(ctx context.Context, matchID string, fn func(match *database.Match) error) (*database.Match, error) {
+	if err := w.lock.Lock(ctx, matchID, nil); err != nil {
+		return nil, ErrMatchLocked
+	}
+	defer w.lock.Unlock(ctx, matchID)
+
+	match, err := w.dbClient.GetMatchByMatchID(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	return match, fn(match)
+}
+
+// startMatchSpan starts a span as part of the trace of the match, which was started by the message creating the match
+func startMatchSpan(ctx context.Context, match *database.Match, name string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(tracing.Extract(ctx, match.TraceContext), name,
+		trace.WithAttributes(attribute.String("match.id", match.MatchID), attribute.String("match.tmt2_id", match.TMT2MatchId)),
+	)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// processMatch advances the job of the match. New matches are placed on the TMT2 backend with the fewest of the live
+// matches, which are counted up for the placement of the following matches.
+func (w *Worker) processMatch(ctx context.Context, match *database.Match, liveMatches map[string]int) error {
 	slog.Debug("start job processing", "Match", match.MatchID)
 
 	switch match.JobState {
 	case models.JOB_STATE_NEW:
+		placed := false
+		if match.TMT2Backend == "" {
+			backend, err := w.tmt2Pool.Place(liveMatches)
+			if err != nil {
+				slog.Warn("error placing tmt2 match", "Match", match.MatchID, "Error", err)
+				return err
+			}
+			match.TMT2Backend = backend
+			liveMatches[backend]++
+			placed = true
+			slog.Info("placed tmt2 match", "Match", match.MatchID, "Backend", backend)
+		}
+
 		createMatchResponse, err := w.createTMT2Match(ctx, match)
 		if err != nil {
 			slog.Error("error creating tmt2 match", "Error", err)
+			// the placement is only kept once the match exists, so the next attempt may use another backend
+			if placed {
+				liveMatches[match.TMT2Backend]--
+				match.TMT2Backend = ""
+			}
+			match.LastError = err.Error()
+			if _, updateErr := w.dbClient.UpdateMatch(ctx, match); updateErr != nil {
+				slog.Error("error updating match", "Error", updateErr)
+			}
 			return err
 		}
 		slog.Info("created tmt2 match", "Match", match.MatchID, "Response", *createMatchResponse)
 
 		match.JobState = models.JOB_STATE_IN_PROGRESS
 		match.TMT2MatchId = createMatchResponse.Id
+		match.LastError = ""
 		_, err = w.dbClient.UpdateMatch(ctx, match)
 		if err != nil {
 			slog.Error("error updating match", "Error", err)
@@ -115,20 +259,42 @@ func (w *Worker) processMatch(ctx context.Context, match *database.Match) error
 				slog.Error("error updating match", "Error", err)
 				return err
 			}
+		} else if match.FinishedAt == nil {
+			return w.checkTMT2Match(ctx, match)
 		}
 	case models.JOB_STATE_FINISHED:
 		slog.Debug("job already finished", "Match", match.MatchID)
-		w.deleteTMT2Match(ctx, match)
+		if match.TMT2DeletedAt != nil {
+			return nil
+		}
+		if err := w.deleteTMT2Match(ctx, match); err != nil {
+			return err
+		}
+		now := time.Now()
+		match.TMT2DeletedAt = &now
+		if _, err := w.dbClient.UpdateMatch(ctx, match); err != nil {
+			slog.Error("error updating match", "Error", err)
+			return err
+		}
+	case models.JOB_STATE_ATTENTION_REQUIRED:
+		slog.Debug("job requires operator attention", "Match", match.MatchID)
 	}
 
 	return nil
 }
 
-func (w *Worker) createTMT2Match(ctx context.Context, match *database.Match) (*tmt2_go.IMatch, error) {
+func (w *Worker) createTMT2Match(ctx context.Context, match *database.Match) (tmt2Match *tmt2_go.IMatch, err error) {
 	slog.Debug("createTMT2Match", "Match", match.MatchID)
+	ctx, span := startMatchSpan(ctx, match, "createTMT2Match")
+	defer func() { endSpan(span, err) }()
+
+	tmt2Client, err := w.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		return nil, err
+	}
 
 	// check if match already exists
-	existingResponse, err := w.tmt2Client.GetMatchByExternalId(ctx, match.MatchID)
+	existingResponse, err := tmt2Client.GetMatchByExternalId(ctx, match.MatchID)
 	if err != nil {
 		slog.Error("error checking for existing tmt2 match", "Error", err)
 	}
@@ -163,7 +329,11 @@ func (w *Worker) createTMT2Match(ctx context.Context, match *database.Match) (*t
 		}, nil
 	}
 
-	response, err := w.tmt2Client.CreateMatch(ctx, &match.MatchInfo)
+	if match.TemplateName == "" {
+		match.TemplateName = tmt2Client.SelectMatchTemplate(&match.MatchInfo)
+	}
+
+	response, err := tmt2Client.CreateMatch(ctx, match.MatchID, match.TemplateName, &match.MatchInfo)
 	if err != nil {
 		slog.Error("error creating tmt2 match", "Error", err)
 		return nil, err
@@ -180,12 +350,179 @@ func (w *Worker) createTMT2Match(ctx context.Context, match *database.Match) (*t
 
 func (w *Worker) deleteTMT2Match(ctx context.Context, match *database.Match) error {
 	slog.Debug("deleteTMT2Match", "Match", match.MatchID)
+	ctx, span := startMatchSpan(ctx, match, "deleteTMT2Match")
 
-	err := w.tmt2Client.DeleteMatch(ctx, match.TMT2MatchId)
+	tmt2Client, err := w.tmt2Pool.Client(match.TMT2Backend)
+	if err == nil {
+		err = tmt2Client.DeleteMatch(ctx, match.TMT2MatchId)
+	}
+	if errors.Is(err, tmt2.ErrNotFound) {
+		slog.Debug("tmt2 match already deleted", "Match", match.MatchID, "TMT2MatchId", match.TMT2MatchId)
+		err = nil
+	}
 	if err != nil {
 		slog.Error("error deleting tmt2 match", "Error", err)
+	}
+
+	endSpan(span, err)
+	return err
+}
+
+// checkTMT2Match checks that the TMT2 match of a running job still exists and is not stopped. Missing matches, e.g.
+// after TMT2 lost its storage, are recreated and stopped matches are revived. TMT2 matches deleted through the api and
+// finished matches are left alone.
+func (w *Worker) checkTMT2Match(ctx context.Context, match *database.Match) error {
+	if match.TMT2DeletedAt != nil {
+		return nil
+	}
+
+	tmt2Client, err := w.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		return err
+	}
+
+	tmt2Match, err := tmt2Client.GetMatchDetails(ctx, match.TMT2MatchId)
+	if errors.Is(err, tmt2.ErrNotFound) {
+		return w.reprovisionTMT2Match(ctx, match)
+	}
+	if err != nil {
+		slog.Error("error getting tmt2 match", "Match", match.MatchID, "Error", err)
+		return err
+	}
+
+	if tmt2Match.State == tmt2_go.TMatchStateFINISHED {
+		// the MATCH_END webhook may have been lost
+		if match.FinishedAt == nil {
+			now := time.Now()
+			match.FinishedAt = &now
+			_, err = w.dbClient.UpdateMatch(ctx, match)
+		}
+		return err
+	}
+
+	if !tmt2Match.IsStopped {
+		// a revived match which is running again is a new incident when it stops the next time
+		if match.ReviveAttempts > 0 {
+			match.ReviveAttempts = 0
+			_, err = w.dbClient.UpdateMatch(ctx, match)
+		}
+		return err
+	}
+
+	return w.reviveStoppedTMT2Match(ctx, match)
+}
+
+// reprovisionTMT2Match recreates a missing TMT2 match from the stored match info and optionally restores the latest
+// round backup of the game server
+func (w *Worker) reprovisionTMT2Match(ctx context.Context, match *database.Match) (err error) {
+	ctx, span := startMatchSpan(ctx, match, "reprovisionTMT2Match")
+	defer func() { endSpan(span, err) }()
+
+	slog.Warn("tmt2 match not found, recreating", "Match", match.MatchID, "TMT2MatchId", match.TMT2MatchId)
+	lostTMT2MatchId := match.TMT2MatchId
+
+	createMatchResponse, err := w.createTMT2Match(ctx, match)
+	if err != nil {
+		slog.Error("error recreating tmt2 match", "Match", match.MatchID, "Error", err)
+		match.LastError = err.Error()
+		if _, updateErr := w.dbClient.UpdateMatch(ctx, match); updateErr != nil {
+			slog.Error("error updating match", "Error", updateErr)
+		}
+		return err
+	}
+
+	now := time.Now()
+	match.TMT2MatchId = createMatchResponse.Id
+	match.ReprovisionedAt = &now
+	match.LastError = ""
+
+	if w.restoreRoundBackup {
+		if err = w.restoreLatestRoundBackup(ctx, match, lostTMT2MatchId); err != nil {
+			slog.Error("error restoring latest round backup", "Match", match.MatchID, "Error", err)
+			match.LastError = err.Error()
+		}
+	}
+
+	_, err = w.dbClient.UpdateMatch(ctx, match)
+	if err != nil {
+		slog.Error("error updating match", "Error", err)
+		return err
+	}
+
+	slog.Info("recreated tmt2 match", "Match", match.MatchID, "TMT2MatchId", match.TMT2MatchId)
+	return nil
+}
+
+// restoreLatestRoundBackup loads the latest round backup of the lost TMT2 match into the recreated match. TMT2 names the
+// round backups after the match id and the lost match is gone, so the backups on the game server are listed through the
+// recreated match and the latest one of the lost match is loaded.
+func (w *Worker) restoreLatestRoundBackup(ctx context.Context, match *database.Match, lostTMT2MatchId string) error {
+	tmt2Client, err := w.tmt2Pool.Client(match.TMT2Backend)
+	if err != nil {
+		return err
+	}
+
+	roundBackups, err := tmt2Client.GetRoundBackups(ctx, match.TMT2MatchId, roundBackupSearchCount)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(roundBackups.LatestFiles, func(file string) bool { return strings.Contains(file, lostTMT2MatchId) })
+	if lostTMT2MatchId == "" || i < 0 {
+		slog.Info("no round backup to restore", "Match", match.MatchID, "TMT2MatchId", lostTMT2MatchId)
+		return nil
+	}
+
+	file := roundBackups.LatestFiles[i]
+	if err = tmt2Client.LoadRoundBackup(ctx, match.TMT2MatchId, file); err != nil {
 		return err
 	}
 
+	match.BackupRestores = append(match.BackupRestores, database.BackupRestore{
+		File:       file,
+		RestoredBy: backupRestoreWorker,
+		RestoredAt: time.Now(),
+	})
 	return nil
 }
+
+// reviveStoppedTMT2Match revives the stopped TMT2 match. If the match could not be revived within the configured
+// attempts, the job requires operator attention and an alert is published.
+func (w *Worker) reviveStoppedTMT2Match(ctx context.Context, match *database.Match) (err error) {
+	ctx, span := startMatchSpan(ctx, match, "reviveStoppedTMT2Match")
+	defer func() { endSpan(span, err) }()
+
+	if match.ReviveAttempts >= w.reviveAttempts {
+		slog.Warn("tmt2 match could not be revived, operator attention required", "Match", match.MatchID, "Attempts", match.ReviveAttempts)
+		// the alert is published first, so it is retried on the next tick if publishing fails
+		if err := messagequeue.PublishMatchMessage(ctx, w.matchPublisher, w.baseTopic, messagequeue.MatchAttentionRequired, &match.MatchInfo); err != nil {
+			slog.Error("error publishing attention required message", "Match", match.MatchID, "Error", err)
+			return err
+		}
+
+		match.JobState = models.JOB_STATE_ATTENTION_REQUIRED
+		if _, err := w.dbClient.UpdateMatch(ctx, match); err != nil {
+			slog.Error("error updating match", "Error", err)
+			return err
+		}
+		return nil
+	}
+
+	match.ReviveAttempts++
+	slog.Warn("tmt2 match stopped unexpectedly, reviving", "Match", match.MatchID, "Attempt", match.ReviveAttempts)
+	tmt2Client, reviveErr := w.tmt2Pool.Client(match.TMT2Backend)
+	if reviveErr == nil {
+		reviveErr = tmt2Client.ReviveMatch(ctx, match.TMT2MatchId)
+	}
+	if reviveErr != nil {
+		slog.Error("error reviving tmt2 match", "Match", match.MatchID, "Error", reviveErr)
+		match.LastError = reviveErr.Error()
+	}
+
+	if _, err := w.dbClient.UpdateMatch(ctx, match); err != nil {
+		slog.Error("error updating match", "Error", err)
+		return errors.Join(reviveErr, err)
+	}
+
+	return reviveErr
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_common/src/go/config"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/messagebroker"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/database"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/environment"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/messagequeue"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/models"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2/tmt2test"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/gammazero/workerpool"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testAccessToken = "test-token"
+
+// testConfigClient serves the templates of the config, game server templates are not used by the worker
+type testConfigClient struct {
+	templates map[string]string
+}
+
+func (c *testConfigClient) GetConfig() *config.Config {
+	return &config.Config{Templates: c.templates}
+}
+
+func (c *testConfigClient) GetGameServerTemplate(string) (*config.GamerServerConfigTemplate, error) {
+	return nil, errors.New("no game server templates")
+}
+
+func (c *testConfigClient) GetGameServerTemplateForMatch(matchservice.MatchInfo) (*config.GamerServerConfigTemplate, error) {
+	return nil, errors.New("no game server templates")
+}
+
+// workerTest is a worker against the fake TMT2 with a memory database and a server receiving the webhooks of TMT2
+type workerTest struct {
+	fake      *tmt2test.Server
+	db        database.DatabaseClient
+	publisher *gochannel.GoChannel
+	server    *Server
+	worker    *Worker
+}
+
+func newWorkerTest(t *testing.T, reviveAttempts int, restoreRoundBackup bool) *workerTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	fake := tmt2test.NewServer(testAccessToken)
+	t.Cleanup(fake.Close)
+
+	srv := &Server{ctx: ctx, env: &environment.Environment{}}
+	webhookRouter := gin.New()
+	webhookRouter.POST("/webhook/:id", srv.webhookHandler)
+	webhook := httptest.NewServer(webhookRouter)
+	t.Cleanup(webhook.Close)
+
+	configClient := &testConfigClient{templates: map[string]string{
+		"match.yaml": "series: bo1\nsideMode: knife\nwebhookUrl: " + webhook.URL + "/webhook/match\n" +
+			"rconCommands:\n  init: [\"say hello\"]\n  end: [\"say bye\"]\n",
+	}}
+
+	backend := tmt2.Backend{Name: "default", URL: fake.URL, AccessToken: testAccessToken}
+	client, err := tmt2.NewTMT2Client(configClient, backend, "match", "", "", tmt2.ResilienceConfig{}, tmt2.TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(ctx, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := tmt2.NewPoolFromClients([]tmt2.Backend{backend}, map[string]tmt2.TMT2Client{backend.Name: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := database.NewMemoryClient()
+	publisher := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+	t.Cleanup(func() { _ = publisher.Close() })
+	wp := workerpool.New(1)
+	t.Cleanup(wp.StopWait)
+
+	worker := NewWorker(ctx, wp, db, publisher, configClient, "test", pool, 0, reviveAttempts, restoreRoundBackup)
+	srv.dbClient = db
+	srv.tmt2Pool = pool
+	srv.worker = worker
+
+	return &workerTest{fake: fake, db: db, publisher: publisher, server: srv, worker: worker}
+}
+
+// createMatch stores a new job for the match and lets the worker create its TMT2 match
+func (wt *workerTest) createMatch(t *testing.T, matchID string) *database.Match {
+	t.Helper()
+
+	matchInfo := tmt2.SampleMatchInfo
+	matchInfo.Id = matchID
+	if _, err := wt.db.CreateMatch(context.Background(), &database.Match{MatchID: matchID, MatchInfo: matchInfo, JobState: models.JOB_STATE_NEW}); err != nil {
+		t.Fatal(err)
+	}
+
+	wt.worker.process()
+	match := getMatch(t, wt.db, matchID)
+	if match.JobState != models.JOB_STATE_IN_PROGRESS || match.TMT2MatchId == "" || match.LastError != "" {
+		t.Fatalf("after create: state = %s, tmt2 match = %q, last error = %q", match.JobState, match.TMT2MatchId, match.LastError)
+	}
+	return match
+}
+
+// TestWorkerLifecycle drives a match through the worker and the webhook against the fake TMT2: the match is created,
+// finished by the MATCH_END webhook and deleted after the delete wait time.
+func TestWorkerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	wt := newWorkerTest(t, 1, false)
+
+	// create
+	match := wt.createMatch(t, "match1")
+	tmt2Match, ok := wt.fake.Match(match.TMT2MatchId)
+	if !ok {
+		t.Fatalf("tmt2 match %s not created", match.TMT2MatchId)
+	}
+	if tmt2Match.Passthrough == nil || *tmt2Match.Passthrough != match.MatchID {
+		t.Errorf("passthrough = %v, want %s", tmt2Match.Passthrough, match.MatchID)
+	}
+	if !slices.Equal(tmt2Match.RconCommands.Init, []string{"say hello"}) || !slices.Equal(tmt2Match.RconCommands.End, []string{"say bye"}) {
+		t.Errorf("rcon commands = %+v", tmt2Match.RconCommands)
+	}
+
+	// a running match is left alone
+	wt.worker.process()
+	if match = getMatch(t, wt.db, match.MatchID); match.JobState != models.JOB_STATE_IN_PROGRESS || match.FinishedAt != nil {
+		t.Fatalf("running match: state = %s, finished at = %v", match.JobState, match.FinishedAt)
+	}
+
+	// webhook
+	if err := wt.fake.FinishMatch(ctx, match.TMT2MatchId); err != nil {
+		t.Fatal(err)
+	}
+	if match = getMatch(t, wt.db, match.MatchID); match.FinishedAt == nil {
+		t.Fatal("finished at not set by the MATCH_END webhook")
+	}
+
+	// finish
+	wt.worker.process()
+	if match = getMatch(t, wt.db, match.MatchID); match.JobState != models.JOB_STATE_FINISHED {
+		t.Fatalf("after finish: state = %s, want %s", match.JobState, models.JOB_STATE_FINISHED)
+	}
+
+	// delete
+	wt.worker.process()
+	if tmt2Match, _ = wt.fake.Match(match.TMT2MatchId); !tmt2Match.IsStopped || tmt2Match.IsLive {
+		t.Errorf("tmt2 match not deleted: stopped = %t, live = %t", tmt2Match.IsStopped, tmt2Match.IsLive)
+	}
+	if match = getMatch(t, wt.db, match.MatchID); match.TMT2DeletedAt == nil {
+		t.Fatal("tmt2 deleted at not set after the delete")
+	}
+
+	// the deleted match is not deleted again, TMT2 would answer not found once it removed the match
+	wt.fake.Reset()
+	wt.worker.process()
+	if deletedAt := getMatch(t, wt.db, match.MatchID).TMT2DeletedAt; deletedAt == nil || !deletedAt.Equal(*match.TMT2DeletedAt) {
+		t.Errorf("tmt2 deleted at = %v, want %v", deletedAt, match.TMT2DeletedAt)
+	}
+}
+
+func TestWorkerFinishesMatchDeletedInTMT2(t *testing.T) {
+	ctx := context.Background()
+	wt := newWorkerTest(t, 1, false)
+	match := wt.createMatch(t, "match1")
+
+	match.JobState = models.JOB_STATE_FINISHED
+	if _, err := wt.db.UpdateMatch(ctx, match); err != nil {
+		t.Fatal(err)
+	}
+	wt.fake.Reset()
+
+	if err := wt.worker.processMatch(ctx, getMatch(t, wt.db, match.MatchID), nil); err != nil {
+		t.Fatalf("processMatch() error = %v, want a missing tmt2 match to count as deleted", err)
+	}
+	if match = getMatch(t, wt.db, match.MatchID); match.TMT2DeletedAt == nil {
+		t.Error("tmt2 deleted at not set")
+	}
+}
+
+func getMatch(t *testing.T, db database.DatabaseClient, matchID string) *database.Match {
+	t.Helper()
+	match, err := db.GetMatchByMatchID(context.Background(), matchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return match
+}
+
+// failingPublisher fails to publish messages, e.g. while the broker is unavailable
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(string, ...*message.Message) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingPublisher) Close() error {
+	return nil
+}
+
+// receiveMessage returns the sub type of the next message published to the topic
+func receiveMessage(t *testing.T, messages <-chan *message.Message) string {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		msg.Ack()
+		var brokerMessage messagebroker.Message
+		if err := json.Unmarshal(msg.Payload, &brokerMessage); err != nil {
+			t.Fatal(err)
+		}
+		return brokerMessage.SubType
+	case <-time.After(time.Second):
+		t.Fatal("no message published")
+		return ""
+	}
+}
+
+func TestWorkerRetriesAttentionAlert(t *testing.T) {
+	wt := newWorkerTest(t, 1, false)
+	match := wt.createMatch(t, "match1")
+
+	// the first stop is revived
+	if err := wt.fake.StopMatch(match.TMT2MatchId); err != nil {
+		t.Fatal(err)
+	}
+	wt.worker.process()
+	if tmt2Match, _ := wt.fake.Match(match.TMT2MatchId); tmt2Match.IsStopped {
+		t.Fatal("stopped tmt2 match not revived")
+	}
+
+	// the alert of the second stop cannot be published, so the job stays in progress
+	if err := wt.fake.StopMatch(match.TMT2MatchId); err != nil {
+		t.Fatal(err)
+	}
+	wt.worker.matchPublisher = failingPublisher{}
+	wt.worker.process()
+	if match = getMatch(t, wt.db, match.MatchID); match.JobState != models.JOB_STATE_IN_PROGRESS {
+		t.Fatalf("state = %s after the alert failed, want %s", match.JobState, models.JOB_STATE_IN_PROGRESS)
+	}
+
+	messages, err := wt.publisher.Subscribe(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt.worker.matchPublisher = wt.publisher
+	wt.worker.process()
+	if match = getMatch(t, wt.db, match.MatchID); match.JobState != models.JOB_STATE_ATTENTION_REQUIRED {
+		t.Errorf("state = %s, want %s", match.JobState, models.JOB_STATE_ATTENTION_REQUIRED)
+	}
+	if subType := receiveMessage(t, messages); subType != messagequeue.MatchAttentionRequired {
+		t.Errorf("published %s, want %s", subType, messagequeue.MatchAttentionRequired)
+	}
+}
+
+func TestWorkerRevivesStoppedMatch(t *testing.T) {
+	wt := newWorkerTest(t, 2, false)
+	match := wt.createMatch(t, "match1")
+	messages, err := wt.publisher.Subscribe(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopAndProcess := func() {
+		t.Helper()
+		if err := wt.fake.StopMatch(match.TMT2MatchId); err != nil {
+			t.Fatal(err)
+		}
+		wt.worker.process()
+		match = getMatch(t, wt.db, match.MatchID)
+	}
+
+	stopAndProcess()
+	if tmt2Match, _ := wt.fake.Match(match.TMT2MatchId); tmt2Match.IsStopped || match.ReviveAttempts != 1 {
+		t.Fatalf("stopped = %t, revive attempts = %d, want revived after 1 attempt", tmt2Match.IsStopped, match.ReviveAttempts)
+	}
+
+	// the revived match runs again, so the next stop is a new incident
+	wt.worker.process()
+	if match = getMatch(t, wt.db, match.MatchID); match.ReviveAttempts != 0 {
+		t.Fatalf("revive attempts = %d of a running match, want 0", match.ReviveAttempts)
+	}
+
+	stopAndProcess()
+	stopAndProcess()
+	if match.JobState != models.JOB_STATE_IN_PROGRESS || match.ReviveAttempts != 2 {
+		t.Fatalf("state = %s, revive attempts = %d, want in progress after 2 attempts", match.JobState, match.ReviveAttempts)
+	}
+
+	stopAndProcess()
+	if match.JobState != models.JOB_STATE_ATTENTION_REQUIRED {
+		t.Errorf("state = %s, want %s", match.JobState, models.JOB_STATE_ATTENTION_REQUIRED)
+	}
+	if subType := receiveMessage(t, messages); subType != messagequeue.MatchAttentionRequired {
+		t.Errorf("published %s, want %s", subType, messagequeue.MatchAttentionRequired)
+	}
+	if tmt2Match, _ := wt.fake.Match(match.TMT2MatchId); !tmt2Match.IsStopped {
+		t.Error("tmt2 match revived after the revive attempts were exhausted")
+	}
+}
+
+func TestWorkerDoesNotReviveDeletedMatch(t *testing.T) {
+	ctx := context.Background()
+	wt := newWorkerTest(t, 1, false)
+	match := wt.createMatch(t, "match1")
+
+	// deleted through the api
+	if err := wt.fake.StopMatch(match.TMT2MatchId); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	match.TMT2DeletedAt = &now
+	if _, err := wt.db.UpdateMatch(ctx, match); err != nil {
+		t.Fatal(err)
+	}
+
+	wt.worker.process()
+	if tmt2Match, _ := wt.fake.Match(match.TMT2MatchId); !tmt2Match.IsStopped {
+		t.Error("deleted tmt2 match revived")
+	}
+	if match = getMatch(t, wt.db, match.MatchID); match.ReviveAttempts != 0 || match.JobState != models.JOB_STATE_IN_PROGRESS {
+		t.Errorf("state = %s, revive attempts = %d, want the job untouched", match.JobState, match.ReviveAttempts)
+	}
+}
+
+func TestWorkerReprovisionsLostMatch(t *testing.T) {
+	wt := newWorkerTest(t, 1, true)
+	lost := wt.createMatch(t, "match1")
+	other := wt.createMatch(t, "match2")
+
+	// the game server of both matches has backups of both, the latest one is of the other match
+	lostBackup := "round_backup_" + lost.TMT2MatchId + "_round05.txt"
+	for _, file := range []string{"round_backup_" + lost.TMT2MatchId + "_round04.txt", lostBackup} {
+		if err := wt.fake.AddRoundBackup(lost.TMT2MatchId, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wt.fake.AddRoundBackup(other.TMT2MatchId, "round_backup_"+other.TMT2MatchId+"_round09.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// TMT2 lost its storage
+	wt.fake.Reset()
+	wt.worker.process()
+
+	match := getMatch(t, wt.db, lost.MatchID)
+	if match.TMT2MatchId == "" || match.TMT2MatchId == lost.TMT2MatchId {
+		t.Fatalf("tmt2 match = %q, want a new match instead of %s", match.TMT2MatchId, lost.TMT2MatchId)
+	}
+	if _, ok := wt.fake.Match(match.TMT2MatchId); !ok {
+		t.Fatalf("tmt2 match %s not created", match.TMT2MatchId)
+	}
+	if match.ReprovisionedAt == nil || match.LastError != "" {
+		t.Errorf("reprovisioned at = %v, last error = %q", match.ReprovisionedAt, match.LastError)
+	}
+	if loaded := wt.fake.LoadedRoundBackups(match.TMT2MatchId); !slices.Equal(loaded, []string{lostBackup}) {
+		t.Errorf("loaded round backups = %v, want %s", loaded, lostBackup)
+	}
+	if len(match.BackupRestores) != 1 || match.BackupRestores[0].File != lostBackup || match.BackupRestores[0].RestoredBy != backupRestoreWorker {
+		t.Errorf("backup restores = %+v, want %s restored by the worker", match.BackupRestores, lostBackup)
+	}
+}
+
+// unreachableTMT2Client is a healthy backend on which creating matches fails
+type unreachableTMT2Client struct {
+	tmt2.TMT2Client
+}
+
+func (unreachableTMT2Client) Available() bool {
+	return true
+}
+
+func (unreachableTMT2Client) Healthy() bool {
+	return true
+}
+
+func (unreachableTMT2Client) GetMatchByExternalId(context.Context, string) (*tmt2_go.IMatchResponse, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (unreachableTMT2Client) SelectMatchTemplate(*matchservice.MatchInfo) string {
+	return "match"
+}
+
+func (unreachableTMT2Client) CreateMatch(context.Context, string, string, *matchservice.MatchInfo) (*tmt2_go.CreateMatchResponse, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestWorkerKeepsPlacementOnlyAfterCreate(t *testing.T) {
+	ctx := context.Background()
+	wt := newWorkerTest(t, 1, false)
+	fakeClient, err := wt.worker.tmt2Pool.Client("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := []tmt2.Backend{{Name: "a"}, {Name: "default"}}
+	pool, err := tmt2.NewPoolFromClients(backends, map[string]tmt2.TMT2Client{"a": unreachableTMT2Client{}, "default": fakeClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt.worker.tmt2Pool = pool
+
+	matchInfo := tmt2.SampleMatchInfo
+	matchInfo.Id = "match1"
+	if _, err = wt.db.CreateMatch(ctx, &database.Match{MatchID: matchInfo.Id, MatchInfo: matchInfo, JobState: models.JOB_STATE_NEW}); err != nil {
+		t.Fatal(err)
+	}
+	match := getMatch(t, wt.db, matchInfo.Id)
+
+	// the create on the least loaded backend fails, so neither the match nor the live matches keep the placement
+	liveMatches := map[string]int{"a": 0, "default": 1}
+	if err = wt.worker.processMatch(ctx, match, liveMatches); err == nil {
+		t.Fatal("processMatch() error = nil, want the create error")
+	}
+	if match = getMatch(t, wt.db, matchInfo.Id); match.TMT2Backend != "" || match.JobState != models.JOB_STATE_NEW || match.LastError == "" {
+		t.Fatalf("backend = %q, state = %s, last error = %q, want an unplaced new match with the error", match.TMT2Backend, match.JobState, match.LastError)
+	}
+	if liveMatches["a"] != 0 || liveMatches["default"] != 1 {
+		t.Fatalf("live matches = %v, want the placement rolled back", liveMatches)
+	}
+
+	// the next attempt may use another backend
+	liveMatches["a"] = 2
+	if err = wt.worker.processMatch(ctx, match, liveMatches); err != nil {
+		t.Fatal(err)
+	}
+	if match = getMatch(t, wt.db, matchInfo.Id); match.TMT2Backend != "default" || match.JobState != models.JOB_STATE_IN_PROGRESS {
+		t.Errorf("backend = %q, state = %s, want in progress on default", match.TMT2Backend, match.JobState)
+	}
+	if liveMatches["default"] != 2 {
+		t.Errorf("live matches = %v, want the placement counted", liveMatches)
+	}
+}
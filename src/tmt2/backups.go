@@ -0,0 +1,54 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"k8s.io/utils/ptr"
+)
+
+// RoundBackups holds the latest round backup files of a match and the total amount of available backups
+type RoundBackups struct {
+	LatestFiles []string `json:"latestFiles"`
+	Total       int      `json:"total"`
+}
+
+// GetRoundBackups returns the latest round backups of a match from the game server. If count is 0, the TMT2 default
+// is used.
+func (t *TMT2ClientImpl) GetRoundBackups(ctx context.Context, matchID string, count int) (*RoundBackups, error) {
+	params := tmt2_go.GetRoundBackupsParams{}
+	if count > 0 {
+		params.Count = ptr.To(float64(count))
+	}
+
+	response, err := t.rawClient.GetRoundBackups(withOperation(ctx, "GetRoundBackups"), matchID, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	var roundBackups RoundBackups
+	if err = decodeResponse(response, &roundBackups); err != nil {
+		return nil, err
+	}
+
+	return &roundBackups, nil
+}
+
+// LoadRoundBackup restores the given round backup file on the game server of a match
+func (t *TMT2ClientImpl) LoadRoundBackup(ctx context.Context, matchID, file string) error {
+	response, err := t.rawClient.LoadRoundBackup(withOperation(ctx, "LoadRoundBackup"), matchID, file)
+	if err != nil {
+		return err
+	}
+
+	var success bool
+	if err = decodeResponse(response, &success); err != nil {
+		return err
+	}
+
+	if !success {
+		return errors.New("tmt2 could not load round backup " + file)
+	}
+
+	return nil
+}
@@ -3,24 +3,61 @@ package tmt2
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/GSH-LAN/Unwindia_common/src/go/config"
 	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
-	"github.com/GSH-LAN/Unwindia_common/src/go/template"
 	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
-	"k8s.io/utils/ptr"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-const jsonContentType = "application/json"
+const (
+	jsonContentType = "application/json"
+	templateSuffix  = ".gohtml"
+)
+
+// ErrNotFound is returned if TMT2 does not know the requested resource
+var ErrNotFound = errors.New("tmt2 resource not found")
+
+// TMT2Client are the operations on the matches of a TMT2 backend
+type TMT2Client interface {
+	Available() bool
+	Healthy() bool
+	SelectMatchTemplate(matchInfo *matchservice.MatchInfo) string
+	CreateMatch(ctx context.Context, externalID, templateName string, matchInfo *matchservice.MatchInfo) (*tmt2_go.CreateMatchResponse, error)
+	GetMatchByExternalId(ctx context.Context, externalID string) (*tmt2_go.IMatchResponse, error)
+	GetMatchDetails(ctx context.Context, matchID string) (*tmt2_go.IMatchResponse, error)
+	UpdateMatch(ctx context.Context, matchID string, update tmt2_go.IMatchUpdateDto) error
+	ReviveMatch(ctx context.Context, matchID string) error
+	DeleteMatch(ctx context.Context, matchID string) error
+	Rcon(ctx context.Context, matchID string, commands []string) ([]string, error)
+	GetRoundBackups(ctx context.Context, matchID string, count int) (*RoundBackups, error)
+	LoadRoundBackup(ctx context.Context, matchID, file string) error
+}
+
+var _ TMT2Client = (*TMT2ClientImpl)(nil)
 
 type TMT2ClientImpl struct {
+	name              string // name of the backend
 	tmt2Client        tmt2_go.ClientWithResponsesInterface
+	rawClient         tmt2_go.ClientInterface // used for operations where the generated response parsing fails
 	config            config.ConfigClient
 	matchTemplateName string
+	matchPresetName   string
+	templateRulesName string
+	healthy           atomic.Bool
+	connected         atomic.Bool
+	connectErr        atomic.Pointer[error]
+	probeErr          atomic.Pointer[error] // error of the last health probe
+	templates         *templateStore        // shared by the clients of all backends of a pool
+	breaker           *circuitBreaker
 }
 
 type enrichedMatchInfo struct {
@@ -29,27 +66,53 @@ type enrichedMatchInfo struct {
 	port      string
 }
 
-func NewTMT2Client(configClient config.ConfigClient, url, adminToken, matchTemplateName string) (*TMT2ClientImpl, error) {
+// NewTMT2Client creates a client of a single backend with its own template store
+func NewTMT2Client(configClient config.ConfigClient, backend Backend, matchTemplateName, matchPresetName, templateRulesName string, resilience ResilienceConfig, tlsConfig TLSConfig) (*TMT2ClientImpl, error) {
+	client, err := newTMT2Client(configClient, backend, matchTemplateName, matchPresetName, templateRulesName, resilience, tlsConfig, newTemplateStore())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = client.checkConfiguredTemplates(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// newTMT2Client creates a client using the template store without validating the templates
+func newTMT2Client(configClient config.ConfigClient, backend Backend, matchTemplateName, matchPresetName, templateRulesName string, resilience ResilienceConfig, tlsConfig TLSConfig, templates *templateStore) (*TMT2ClientImpl, error) {
+	transportTLSConfig, err := tlsConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	breaker := newCircuitBreaker(backend.Name, resilience.BreakerFailures, resilience.BreakerOpenDuration)
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			MaxIdleConns:          20,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       600 * time.Second,
-			TLSHandshakeTimeout:   30 * time.Second,
-			ExpectContinueTimeout: 30 * time.Second,
-			ResponseHeaderTimeout: 30 * time.Second,
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+		Transport: &resilientTransport{
+			config:  resilience,
+			breaker: breaker,
+			next: &instrumentedTransport{
+				next: &http.Transport{
+					Proxy:                 http.ProxyFromEnvironment,
+					MaxIdleConns:          20,
+					MaxIdleConnsPerHost:   10,
+					IdleConnTimeout:       600 * time.Second,
+					TLSHandshakeTimeout:   30 * time.Second,
+					ExpectContinueTimeout: 30 * time.Second,
+					ResponseHeaderTimeout: 30 * time.Second,
+					TLSClientConfig:       transportTLSConfig,
+				},
+			},
 		},
 	}
 
 	authorizedRequestEditor := func(ctx context.Context, req *http.Request) error {
-		req.Header.Add("Authorization", adminToken)
+		req.Header.Add("Authorization", backend.AccessToken)
 		return nil
 	}
 
 	tmt2Client, err := tmt2_go.NewClientWithResponses(
-		url,
+		backend.URL,
 		tmt2_go.WithHTTPClient(httpClient),
 		tmt2_go.WithRequestEditorFn(authorizedRequestEditor),
 	)
@@ -57,37 +120,99 @@ func NewTMT2Client(configClient config.ConfigClient, url, adminToken, matchTempl
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	response, err := tmt2Client.Login(ctx)
-	if err != nil {
-		return nil, err
+	client := &TMT2ClientImpl{
+		name:              backend.Name,
+		config:            configClient,
+		tmt2Client:        tmt2Client,
+		rawClient:         tmt2Client.ClientInterface,
+		matchTemplateName: matchTemplateName,
+		matchPresetName:   matchPresetName,
+		templateRulesName: templateRulesName,
+		breaker:           breaker,
+		templates:         templates,
 	}
 
-	slog.Debug("tmt2Client Login respone", "response", *response)
+	return client, nil
+}
 
-	matchTemplateName = fmt.Sprintf("%s.gohtml", matchTemplateName)
-	// verify template exists
-	_, ok := configClient.GetConfig().Templates[matchTemplateName]
-	if !ok {
-		return nil, fmt.Errorf("template %s not found", matchTemplateName)
+// checkConfiguredTemplates validates the templates on startup. The match preset is checked when connecting, the
+// templates are only read from the config and fail the start.
+func (t *TMT2ClientImpl) checkConfiguredTemplates() error {
+	if t.matchPresetName != "" {
+		return nil
 	}
+	return t.CheckTemplates(context.Background())
+}
 
-	return &TMT2ClientImpl{
-		config:            configClient,
-		tmt2Client:        tmt2Client,
-		matchTemplateName: matchTemplateName,
-	}, nil
+// CheckTemplates verifies the match preset, or that the match template and all templates of the template rules have
+// a valid version
+func (t *TMT2ClientImpl) CheckTemplates(ctx context.Context) error {
+	if t.matchPresetName != "" {
+		_, err := t.GetPreset(ctx, t.matchPresetName)
+		return err
+	}
+
+	if err := t.validateTemplateRules(); err != nil {
+		return err
+	}
+
+	return t.ReloadTemplates()
+}
+
+// TemplatesReady returns an error if the match template or a template of the template rules has no valid version.
+// Unlike CheckTemplates it neither reads nor activates changed templates, so it can be used by the readiness check.
+func (t *TMT2ClientImpl) TemplatesReady() error {
+	if t.matchPresetName != "" {
+		return nil
+	}
+
+	t.templates.mu.Lock()
+	defer t.templates.mu.Unlock()
+
+	var errs []error
+	for _, name := range t.matchTemplateNames() {
+		if _, ok := t.templates.active[name]; !ok {
+			errs = append(errs, fmt.Errorf("template %s has no valid version", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MatchTemplate returns the match template or, if there is no template, the match spec with the given name. The name
+// may include the file extension.
+func (t *TMT2ClientImpl) MatchTemplate(name string) (MatchTemplateSource, bool) {
+	templates := t.config.GetConfig().Templates
+	if templateText, ok := templates[strings.TrimSuffix(name, templateSuffix)+templateSuffix]; ok {
+		return MatchTemplateSource{Text: templateText}, true
+	}
+
+	for _, suffix := range specSuffixes {
+		if specText, ok := templates[strings.TrimSuffix(name, suffix)+suffix]; ok {
+			return MatchTemplateSource{Text: specText, Spec: true}, true
+		}
+	}
+
+	return MatchTemplateSource{}, false
 }
 
-func (t *TMT2ClientImpl) CreateMatch(ctx context.Context, matchInfo *matchservice.MatchInfo) (*tmt2_go.CreateMatchResponse, error) {
+// CreateMatch creates a new match in TMT2. If a preset is configured the match is based on the preset, otherwise the
+// given match template is used. The externalID is set as passthrough for presets, templates have to set it on their own.
+func (t *TMT2ClientImpl) CreateMatch(ctx context.Context, externalID, templateName string, matchInfo *matchservice.MatchInfo) (*tmt2_go.CreateMatchResponse, error) {
+	if t.matchPresetName != "" {
+		return t.CreateMatchFromPreset(ctx, t.matchPresetName, externalID, matchInfo)
+	}
 
-	parsedTmt2MatchTemplate, err := template.ParseTemplateForMatch(t.config.GetConfig().Templates[t.matchTemplateName], matchInfo)
+	matchTemplate, err := t.activeTemplate(templateName)
 	if err != nil {
-		slog.Error("Error parsing template", "err", err)
 		return nil, err
 	}
 
+	parsedTmt2MatchTemplate, templateErrors := matchTemplate.Render(externalID, matchInfo)
+	if len(templateErrors) > 0 {
+		slog.Error("Error rendering template", "template", templateName, "errors", templateErrors)
+		return nil, templateErrors[0]
+	}
+
 	//bytes, err := json.Marshal(parsedTmt2MatchTemplate)
 	//if err != nil {
 	//	return nil, err
@@ -102,7 +227,7 @@ func (t *TMT2ClientImpl) CreateMatch(ctx context.Context, matchInfo *matchservic
 	buf := []byte(parsedTmt2MatchTemplate)
 	bodyReader := bytes.NewReader(buf)
 	//response, err := t.tmt2Client.CreateMatch(ctx, tmt2RequestBody)
-	createMatchResponse, err := t.tmt2Client.CreateMatchWithBodyWithResponse(ctx, jsonContentType, bodyReader)
+	createMatchResponse, err := t.tmt2Client.CreateMatchWithBodyWithResponse(withOperation(ctx, "CreateMatch"), jsonContentType, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -118,16 +243,16 @@ func (t *TMT2ClientImpl) CreateMatch(ctx context.Context, matchInfo *matchservic
 
 // GetMatch returns current match state from TMT2
 func (t *TMT2ClientImpl) GetMatch(ctx context.Context, matchID string) (*tmt2_go.GetMatchResponse, error) {
-	return t.tmt2Client.GetMatchWithResponse(ctx, matchID)
+	return t.tmt2Client.GetMatchWithResponse(withOperation(ctx, "GetMatch"), matchID)
 }
 
-// GetMatchByExternalId returns current match state from TMT2 by external id
+// GetMatchByExternalId returns current match state from TMT2 by external id. Stopped matches are returned as well, so
+// they are revived instead of created again, but a live match is preferred.
 func (t *TMT2ClientImpl) GetMatchByExternalId(ctx context.Context, externalID string) (*tmt2_go.IMatchResponse, error) {
 	passthrough := []string{externalID}
 
-	allmatches, err := t.tmt2Client.GetAllMatchesWithResponse(ctx, &tmt2_go.GetAllMatchesParams{
+	allmatches, err := t.tmt2Client.GetAllMatchesWithResponse(withOperation(ctx, "GetAllMatches"), &tmt2_go.GetAllMatchesParams{
 		Passthrough: &passthrough,
-		IsLive:      ptr.To(true),
 	})
 	if err != nil {
 		return nil, err
@@ -138,12 +263,89 @@ func (t *TMT2ClientImpl) GetMatchByExternalId(ctx context.Context, externalID st
 	}
 
 	matches := *allmatches.JSON200
+	if i := slices.IndexFunc(matches, func(match tmt2_go.IMatchResponse) bool { return match.IsLive }); i >= 0 {
+		return &matches[i], nil
+	}
 
 	return &matches[0], nil
 }
 
+// decodeResponse decodes the json body of a raw TMT2 response into v and returns an error for non-successful responses
+func decodeResponse(response *http.Response, v any) error {
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if response.StatusCode > 299 {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("tmt2 request failed: %s: %s", response.Status, string(body))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
 // DeleteMatch deletes a match from TMT2
 func (t *TMT2ClientImpl) DeleteMatch(ctx context.Context, matchID string) error {
-	_, err := t.tmt2Client.DeleteMatchWithResponse(ctx, matchID)
-	return err
+	response, err := t.tmt2Client.DeleteMatchWithResponse(withOperation(ctx, "DeleteMatch"), matchID)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if response.StatusCode() > 299 {
+		return errors.New("error deleting tmt2 match: " + response.Status())
+	}
+
+	return nil
+}
+
+// GetMatchDetails returns the current match state from TMT2 decoded as match response
+func (t *TMT2ClientImpl) GetMatchDetails(ctx context.Context, matchID string) (*tmt2_go.IMatchResponse, error) {
+	response, err := t.rawClient.GetMatch(withOperation(ctx, "GetMatch"), matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	var match tmt2_go.IMatchResponse
+	if err = decodeResponse(response, &match); err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+// UpdateMatch updates a match in TMT2
+func (t *TMT2ClientImpl) UpdateMatch(ctx context.Context, matchID string, update tmt2_go.IMatchUpdateDto) error {
+	response, err := t.tmt2Client.UpdateMatchWithResponse(withOperation(ctx, "UpdateMatch"), matchID, update)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode() > 299 {
+		return errors.New("error updating tmt2 match: " + response.Status() + ": " + string(response.Body))
+	}
+
+	return nil
+}
+
+// ReviveMatch revives a stopped match in TMT2
+func (t *TMT2ClientImpl) ReviveMatch(ctx context.Context, matchID string) error {
+	response, err := t.tmt2Client.ReviveMatchWithResponse(withOperation(ctx, "ReviveMatch"), matchID)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode() > 299 {
+		return errors.New("error reviving tmt2 match: " + response.Status())
+	}
+
+	return nil
 }
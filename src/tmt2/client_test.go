@@ -0,0 +1,81 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_common/src/go/config"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2/tmt2test"
+	"testing"
+	"time"
+)
+
+const testAccessToken = "test-token"
+
+// testConfigClient serves the templates of the config
+type testConfigClient struct {
+	templates map[string]string
+}
+
+func (c *testConfigClient) GetConfig() *config.Config {
+	return &config.Config{Templates: c.templates}
+}
+
+func (c *testConfigClient) GetGameServerTemplate(string) (*config.GamerServerConfigTemplate, error) {
+	return nil, errors.New("no game server templates")
+}
+
+func (c *testConfigClient) GetGameServerTemplateForMatch(matchservice.MatchInfo) (*config.GamerServerConfigTemplate, error) {
+	return nil, errors.New("no game server templates")
+}
+
+// newTestClient returns a client connected to the fake TMT2, which creates matches from a bo1 match spec
+func newTestClient(t *testing.T, fake *tmt2test.Server, resilience ResilienceConfig) *TMT2ClientImpl {
+	t.Helper()
+
+	configClient := &testConfigClient{templates: map[string]string{"match.yaml": "series: bo1\n"}}
+	client, err := NewTMT2Client(configClient, Backend{Name: "test", URL: fake.URL, AccessToken: testAccessToken}, "match", "", "", resilience, TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGetMatchByExternalId(t *testing.T) {
+	ctx := context.Background()
+	fake := tmt2test.NewServer(testAccessToken)
+	defer fake.Close()
+	client := newTestClient(t, fake, ResilienceConfig{})
+
+	if _, err := client.GetMatchByExternalId(ctx, "match1"); err == nil {
+		t.Fatal("GetMatchByExternalId() of an unknown match error = nil")
+	}
+
+	matchInfo := SampleMatchInfo
+	stopped, err := client.CreateMatch(ctx, "match1", "match", &matchInfo)
+	if err != nil || stopped.JSON201 == nil {
+		t.Fatalf("CreateMatch() = %v, %v", stopped, err)
+	}
+	if err = fake.StopMatch(stopped.JSON201.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := client.GetMatchByExternalId(ctx, "match1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.Id != stopped.JSON201.Id || !match.IsStopped {
+		t.Errorf("GetMatchByExternalId() = %s, stopped = %t, want the stopped match %s", match.Id, match.IsStopped, stopped.JSON201.Id)
+	}
+
+	live, err := client.CreateMatch(ctx, "match1", "match", &matchInfo)
+	if err != nil || live.JSON201 == nil {
+		t.Fatalf("CreateMatch() = %v, %v", live, err)
+	}
+	if match, err = client.GetMatchByExternalId(ctx, "match1"); err != nil || match.Id != live.JSON201.Id {
+		t.Errorf("GetMatchByExternalId() = %v, %v, want the live match %s", match, err, live.JSON201.Id)
+	}
+}
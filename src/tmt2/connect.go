@@ -0,0 +1,86 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+const (
+	connectTimeout   = 5 * time.Second
+	connectBaseDelay = time.Second
+)
+
+// ErrNotConnected is returned by the readiness check while the client has not connected to TMT2 yet
+var ErrNotConnected = errors.New("not connected to tmt2 yet")
+
+// Connect logs in to TMT2 and, in preset mode, checks the match preset. Failed attempts are retried with jittered
+// exponential backoff up to maxDelay until they succeed or the context is done.
+func (t *TMT2ClientImpl) Connect(ctx context.Context, maxDelay time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		err := t.connect(ctx)
+		if err == nil {
+			t.connectErr.Store(nil)
+			t.probeErr.Store(nil)
+			t.healthy.Store(true)
+			t.connected.Store(true)
+			slog.Info("Connected to TMT2", "backend", t.name, "attempts", attempt+1)
+			return nil
+		}
+		t.connectErr.Store(&err)
+
+		delay := connectBaseDelay << min(attempt, 16)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		slog.Warn("Error connecting to TMT2, retrying", "backend", t.name, "err", err, "attempt", attempt+1, "delay", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *TMT2ClientImpl) connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	response, err := t.rawClient.Login(withOperation(ctx, "Login"))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("error logging in to tmt2: %s", response.Status)
+	}
+
+	if t.matchPresetName != "" {
+		if _, err = t.GetPreset(ctx, t.matchPresetName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Connected reports whether the client has connected to TMT2
+func (t *TMT2ClientImpl) Connected() bool {
+	return t.connected.Load()
+}
+
+// ConnectionError returns ErrNotConnected with the error of the last connection attempt until the client is connected
+func (t *TMT2ClientImpl) ConnectionError() error {
+	if t.connected.Load() {
+		return nil
+	}
+	if err := t.connectErr.Load(); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotConnected, *err)
+	}
+	return ErrNotConnected
+}
@@ -0,0 +1,76 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const healthProbeTimeout = 5 * time.Second
+
+// Probe checks that TMT2 is reachable and accepts the access token
+func (t *TMT2ClientImpl) Probe(ctx context.Context) error {
+	infosResponse, err := t.tmt2Client.GetInfosWithResponse(withOperation(ctx, "GetInfos"))
+	if err != nil {
+		return err
+	}
+	if infosResponse.JSON200 == nil {
+		return errors.New("error getting tmt2 infos: " + infosResponse.Status())
+	}
+
+	configResponse, err := t.tmt2Client.GetConfigWithResponse(withOperation(ctx, "GetConfig"))
+	if err != nil {
+		return err
+	}
+	if configResponse.JSON200 == nil {
+		return errors.New("error getting tmt2 config: " + configResponse.Status())
+	}
+
+	return nil
+}
+
+// Healthy returns the result of the last health probe
+func (t *TMT2ClientImpl) Healthy() bool {
+	return t.healthy.Load()
+}
+
+// ProbeError returns the error of the last health probe, or nil if it succeeded
+func (t *TMT2ClientImpl) ProbeError() error {
+	if err := t.probeErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// StartHealthProbe probes TMT2 in the given interval until the context is done. onRecovered is called every time TMT2
+// is healthy again after a failed probe, since TMT2 may have been restarted and lost matches in the meantime.
+func (t *TMT2ClientImpl) StartHealthProbe(ctx context.Context, interval time.Duration, onRecovered func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+			err := t.Probe(probeCtx)
+			cancel()
+
+			if err != nil {
+				t.probeErr.Store(&err)
+				if t.healthy.Swap(false) {
+					slog.Error("TMT2 health probe failed", "backend", t.name, "err", err)
+				}
+				continue
+			}
+
+			t.probeErr.Store(nil)
+			if !t.healthy.Swap(true) {
+				slog.Info("TMT2 is healthy again", "backend", t.name)
+				onRecovered()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
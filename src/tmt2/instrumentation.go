@@ -0,0 +1,80 @@
+package tmt2
+
+import (
+	"context"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const unknownOperation = "unknown"
+
+type operationKey struct{}
+
+// withOperation adds the name of the TMT2 operation to the context, so requests can be labelled by operation
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+func operationFromContext(ctx context.Context) string {
+	if operation, ok := ctx.Value(operationKey{}).(string); ok {
+		return operation
+	}
+	return unknownOperation
+}
+
+// instrumentedTransport records count and latency of every request to TMT2 per operation and status code. Requests
+// made as part of a trace get a client span and carry the trace context to TMT2.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := operationFromContext(req.Context())
+
+	var span trace.Span
+	if trace.SpanContextFromContext(req.Context()).IsValid() {
+		var ctx context.Context
+		ctx, span = tracing.Tracer().Start(req.Context(), "tmt2 "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.path", req.URL.Path)),
+		)
+		defer span.End()
+
+		req = req.Clone(ctx)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(req)
+
+	statusCode := "error"
+	if err == nil {
+		statusCode = strconv.Itoa(response.StatusCode)
+	}
+
+	if span != nil {
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case response.StatusCode > 299:
+			span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+			span.SetStatus(codes.Error, response.Status)
+		default:
+			span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+		}
+	}
+
+	metrics.TMT2Requests.WithLabelValues(operation, statusCode).Inc()
+	metrics.TMT2RequestDuration.WithLabelValues(operation, statusCode).Observe(time.Since(start).Seconds())
+
+	return response, err
+}
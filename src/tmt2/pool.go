@@ -0,0 +1,165 @@
+package tmt2
+
+import (
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/config"
+)
+
+var (
+	// ErrUnknownBackend is returned for matches placed on a backend which is no longer configured
+	ErrUnknownBackend = errors.New("unknown tmt2 backend")
+	// ErrNoBackendAvailable is returned if no healthy backend has capacity for another match
+	ErrNoBackendAvailable = errors.New("no tmt2 backend available")
+)
+
+// Backend is a TMT2 instance matches can be placed on
+type Backend struct {
+	Name           string
+	URL            string
+	AccessToken    string
+	MaxLiveMatches int // 0 is unlimited
+}
+
+// Pool holds a client for every TMT2 backend and places new matches on them
+type Pool struct {
+	backends []Backend
+	clients  map[string]TMT2Client
+	impls    map[string]*TMT2ClientImpl // clients created by NewPool, which are connected and probed by the server
+}
+
+// NewPool creates the clients of the backends. The templates are read from the same config, so one template store is
+// shared by all clients and the templates are validated once.
+func NewPool(configClient config.ConfigClient, backends []Backend, matchTemplateName, matchPresetName, templateRulesName string, resilience ResilienceConfig, tlsConfig TLSConfig) (*Pool, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no tmt2 backends configured")
+	}
+
+	pool := &Pool{
+		backends: backends,
+		clients:  make(map[string]TMT2Client, len(backends)),
+		impls:    make(map[string]*TMT2ClientImpl, len(backends)),
+	}
+
+	templates := newTemplateStore()
+	for _, backend := range backends {
+		if _, ok := pool.impls[backend.Name]; ok {
+			return nil, fmt.Errorf("duplicate tmt2 backend %q", backend.Name)
+		}
+
+		client, err := newTMT2Client(configClient, backend, matchTemplateName, matchPresetName, templateRulesName, resilience, tlsConfig, templates)
+		if err != nil {
+			return nil, fmt.Errorf("tmt2 backend %s: %w", backend.Name, err)
+		}
+		pool.clients[backend.Name] = client
+		pool.impls[backend.Name] = client
+	}
+
+	if err := pool.Default().checkConfiguredTemplates(); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// NewPoolFromClients creates a pool of the given clients, e.g. fakes in tests. Every backend requires a client.
+func NewPoolFromClients(backends []Backend, clients map[string]TMT2Client) (*Pool, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no tmt2 backends configured")
+	}
+
+	for _, backend := range backends {
+		if _, ok := clients[backend.Name]; !ok {
+			return nil, fmt.Errorf("no client for tmt2 backend %q", backend.Name)
+		}
+	}
+
+	return &Pool{backends: backends, clients: clients, impls: make(map[string]*TMT2ClientImpl)}, nil
+}
+
+// Default returns the client of the first backend, which also serves matches stored before backends were introduced.
+// It is nil for pools created from other clients.
+func (p *Pool) Default() *TMT2ClientImpl {
+	return p.impls[p.backends[0].Name]
+}
+
+// Name resolves the backend name stored on a match, an empty name is the first backend
+func (p *Pool) Name(name string) string {
+	if name == "" {
+		return p.backends[0].Name
+	}
+	return name
+}
+
+// Client returns the client of the backend
+func (p *Pool) Client(name string) (TMT2Client, error) {
+	client, ok := p.clients[p.Name(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+	}
+	return client, nil
+}
+
+// Names returns the names of all backends
+func (p *Pool) Names() []string {
+	names := make([]string, 0, len(p.backends))
+	for _, backend := range p.backends {
+		names = append(names, backend.Name)
+	}
+	return names
+}
+
+// Clients returns the clients created by NewPool by backend name
+func (p *Pool) Clients() map[string]*TMT2ClientImpl {
+	return p.impls
+}
+
+// BackendStatus is the state of the connection to a TMT2 backend
+type BackendStatus struct {
+	Connected bool   `json:"connected"`
+	Available bool   `json:"available"`       // connected and the circuit breaker is closed
+	Healthy   bool   `json:"healthy"`         // result of the last health probe
+	Error     string `json:"error,omitempty"` // error of the last connection attempt while not connected
+}
+
+// Status returns the state of the backends created by NewPool by backend name
+func (p *Pool) Status() map[string]BackendStatus {
+	status := make(map[string]BackendStatus, len(p.impls))
+	for name, client := range p.impls {
+		backendStatus := BackendStatus{Connected: client.Connected(), Available: client.Available(), Healthy: client.Healthy()}
+		if err := client.ConnectionError(); err != nil {
+			backendStatus.Error = err.Error()
+		}
+		status[name] = backendStatus
+	}
+	return status
+}
+
+// Available reports whether requests to the backend are currently possible
+func (p *Pool) Available(name string) bool {
+	client, err := p.Client(name)
+	return err == nil && client.Available()
+}
+
+// Place returns the available and healthy backend with the fewest live matches which has capacity for another match.
+// Ties are resolved in the configured order of the backends.
+func (p *Pool) Place(liveMatches map[string]int) (string, error) {
+	placement := ""
+	for _, backend := range p.backends {
+		live := liveMatches[backend.Name]
+		if backend.MaxLiveMatches > 0 && live >= backend.MaxLiveMatches {
+			continue
+		}
+		if client := p.clients[backend.Name]; !client.Available() || !client.Healthy() {
+			continue
+		}
+		if placement == "" || live < liveMatches[placement] {
+			placement = backend.Name
+		}
+	}
+
+	if placement == "" {
+		return "", ErrNoBackendAvailable
+	}
+	return placement, nil
+}
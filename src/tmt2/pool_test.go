@@ -0,0 +1,116 @@
+package tmt2
+
+import (
+	"errors"
+	"testing"
+)
+
+// stubClient is a backend with a fixed state, the operations on matches are not used by the placement
+type stubClient struct {
+	TMT2Client
+	available bool
+	healthy   bool
+}
+
+func (c *stubClient) Available() bool {
+	return c.available
+}
+
+func (c *stubClient) Healthy() bool {
+	return c.healthy
+}
+
+func TestPoolPlace(t *testing.T) {
+	up := &stubClient{available: true, healthy: true}
+	unavailable := &stubClient{available: false, healthy: true}
+	unhealthy := &stubClient{available: true, healthy: false}
+
+	tests := []struct {
+		name        string
+		backends    []Backend
+		clients     map[string]TMT2Client
+		liveMatches map[string]int
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "least loaded",
+			backends:    []Backend{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			clients:     map[string]TMT2Client{"a": up, "b": up, "c": up},
+			liveMatches: map[string]int{"a": 3, "b": 1, "c": 2},
+			want:        "b",
+		},
+		{
+			name:        "tie in configured order",
+			backends:    []Backend{{Name: "b"}, {Name: "a"}},
+			clients:     map[string]TMT2Client{"a": up, "b": up},
+			liveMatches: map[string]int{"a": 1, "b": 1},
+			want:        "b",
+		},
+		{
+			name:        "backend without live matches",
+			backends:    []Backend{{Name: "a"}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": up, "b": up},
+			liveMatches: map[string]int{"a": 1},
+			want:        "b",
+		},
+		{
+			name:        "max live matches reached",
+			backends:    []Backend{{Name: "a", MaxLiveMatches: 2}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": up, "b": up},
+			liveMatches: map[string]int{"a": 2, "b": 5},
+			want:        "b",
+		},
+		{
+			name:        "below max live matches",
+			backends:    []Backend{{Name: "a", MaxLiveMatches: 2}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": up, "b": up},
+			liveMatches: map[string]int{"a": 1, "b": 5},
+			want:        "a",
+		},
+		{
+			name:        "skip unavailable",
+			backends:    []Backend{{Name: "a"}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": unavailable, "b": up},
+			liveMatches: map[string]int{"a": 0, "b": 5},
+			want:        "b",
+		},
+		{
+			name:        "skip unhealthy",
+			backends:    []Backend{{Name: "a"}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": unhealthy, "b": up},
+			liveMatches: map[string]int{"a": 0, "b": 5},
+			want:        "b",
+		},
+		{
+			name:        "all full",
+			backends:    []Backend{{Name: "a", MaxLiveMatches: 1}, {Name: "b", MaxLiveMatches: 1}},
+			clients:     map[string]TMT2Client{"a": up, "b": up},
+			liveMatches: map[string]int{"a": 1, "b": 1},
+			wantErr:     ErrNoBackendAvailable,
+		},
+		{
+			name:        "none up",
+			backends:    []Backend{{Name: "a"}, {Name: "b"}},
+			clients:     map[string]TMT2Client{"a": unavailable, "b": unhealthy},
+			liveMatches: map[string]int{},
+			wantErr:     ErrNoBackendAvailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewPoolFromClients(tt.backends, tt.clients)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := pool.Place(tt.liveMatches)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Place() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Place() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tmt2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GetPreset returns the TMT2 preset with the given name or id
+func (t *TMT2ClientImpl) GetPreset(ctx context.Context, nameOrId string) (*tmt2_go.IPreset, error) {
+	response, err := t.tmt2Client.GetPresetsWithResponse(withOperation(ctx, "GetPresets"))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.JSON200 == nil {
+		return nil, errors.New("error getting tmt2 presets: " + response.Status())
+	}
+
+	for _, preset := range *response.JSON200 {
+		if preset.Name == nameOrId || preset.Id == nameOrId {
+			return &preset, nil
+		}
+	}
+
+	return nil, fmt.Errorf("preset %s not found", nameOrId)
+}
+
+// CreateMatchFromPreset creates a new match in TMT2 with the data of the given preset as base. Teams, game server and
+// passthrough are taken from the match info.
+func (t *TMT2ClientImpl) CreateMatchFromPreset(ctx context.Context, presetName, externalID string, matchInfo *matchservice.MatchInfo) (*tmt2_go.CreateMatchResponse, error) {
+	preset, err := t.GetPreset(ctx, presetName)
+	if err != nil {
+		slog.Error("Error getting preset", "preset", presetName, "err", err)
+		return nil, err
+	}
+
+	createMatchDto, err := applyMatchInfo(preset.Data, externalID, matchInfo)
+	if err != nil {
+		slog.Error("Error applying match info to preset", "preset", presetName, "err", err)
+		return nil, err
+	}
+
+	return t.tmt2Client.CreateMatchWithResponse(withOperation(ctx, "CreateMatch"), *createMatchDto)
+}
+
+// applyMatchInfo overlays teams, game server and passthrough of the match info on top of the given match create dto
+func applyMatchInfo(createMatchDto tmt2_go.IMatchCreateDto, externalID string, matchInfo *matchservice.MatchInfo) (*tmt2_go.IMatchCreateDto, error) {
+	if matchInfo == nil {
+		return nil, errors.New("empty matchinfo")
+	}
+
+	createMatchDto.Passthrough = &externalID
+	createMatchDto.TeamA = applyTeam(createMatchDto.TeamA, matchInfo.Team1)
+	createMatchDto.TeamB = applyTeam(createMatchDto.TeamB, matchInfo.Team2)
+
+	if matchInfo.ServerAddress != "" {
+		host, port, err := net.SplitHostPort(matchInfo.ServerAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+
+		gameServer := tmt2_go.IGameServer{}
+		if createMatchDto.GameServer != nil {
+			gameServer = *createMatchDto.GameServer
+		}
+		gameServer.Ip = host
+		gameServer.Port = float64(portNumber)
+		gameServer.RconPassword = matchInfo.ServerPasswordMgmt
+		createMatchDto.GameServer = &gameServer
+	}
+
+	return &createMatchDto, nil
+}
+
+func applyTeam(team tmt2_go.ITeamCreateDto, matchTeam matchservice.Team) tmt2_go.ITeamCreateDto {
+	team.Name = matchTeam.Name
+	if matchTeam.Id != "" {
+		passthrough := matchTeam.Id
+		team.Passthrough = &passthrough
+	}
+	return team
+}
+
+// SyncPresets creates or updates a TMT2 preset named after every match template or match spec with the given prefix.
+// The presets are rendered from the last known good version of the template store with sample match data. Game server
+// and passthrough are removed, since they are match specific.
+func (t *TMT2ClientImpl) SyncPresets(ctx context.Context, templatePrefix string) error {
+	response, err := t.tmt2Client.GetPresetsWithResponse(withOperation(ctx, "GetPresets"))
+	if err != nil {
+		return err
+	}
+
+	if response.JSON200 == nil {
+		return errors.New("error getting tmt2 presets: " + response.Status())
+	}
+
+	existingPresets := make(map[string]tmt2_go.IPreset)
+	for _, preset := range *response.JSON200 {
+		existingPresets[preset.Name] = preset
+	}
+
+	var presetNames []string
+	for templateName := range t.config.GetConfig().Templates {
+		if !strings.HasPrefix(templateName, templatePrefix) {
+			continue
+		}
+		for _, suffix := range append([]string{templateSuffix}, specSuffixes...) {
+			if presetName, ok := strings.CutSuffix(templateName, suffix); ok && !slices.Contains(presetNames, presetName) {
+				presetNames = append(presetNames, presetName)
+			}
+		}
+	}
+	slices.Sort(presetNames)
+
+	var errs []error
+	for _, presetName := range presetNames {
+		if err = t.syncPreset(ctx, presetName, existingPresets); err != nil {
+			slog.Error("Error syncing preset", "preset", presetName, "err", err)
+			errs = append(errs, fmt.Errorf("preset %s: %w", presetName, err))
+			continue
+		}
+		slog.Info("Synced preset", "preset", presetName)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t *TMT2ClientImpl) syncPreset(ctx context.Context, presetName string, existingPresets map[string]tmt2_go.IPreset) error {
+	source, err := t.activeTemplate(presetName)
+	if err != nil {
+		return err
+	}
+
+	sampleMatchInfo := SampleMatchInfo
+	rendered, templateErrors := source.Render(sampleMatchInfo.Id, &sampleMatchInfo)
+	if len(templateErrors) > 0 {
+		return templateErrors[0]
+	}
+
+	var createMatchDto tmt2_go.IMatchCreateDto
+	if err = json.Unmarshal(rendered, &createMatchDto); err != nil {
+		return err
+	}
+	createMatchDto.GameServer = nil
+	createMatchDto.Passthrough = nil
+
+	if preset, ok := existingPresets[presetName]; ok {
+		preset.Data = createMatchDto
+		response, err := t.tmt2Client.UpdatePresetWithResponse(withOperation(ctx, "UpdatePreset"), preset)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode() > 299 {
+			return errors.New("error updating preset: " + response.Status())
+		}
+		return nil
+	}
+
+	response, err := t.tmt2Client.CreatePresetWithResponse(withOperation(ctx, "CreatePreset"), tmt2_go.IPresetCreateDto{
+		Name: presetName,
+		Data: createMatchDto,
+	})
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() > 299 {
+		return errors.New("error creating preset: " + response.Status())
+	}
+	return nil
+}
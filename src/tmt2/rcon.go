@@ -0,0 +1,20 @@
+package tmt2
+
+import (
+	"context"
+)
+
+// Rcon executes the commands on the game server of a match and returns the output of each command
+func (t *TMT2ClientImpl) Rcon(ctx context.Context, matchID string, commands []string) ([]string, error) {
+	response, err := t.rawClient.Rcon(withOperation(ctx, "Rcon"), matchID, commands)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []string
+	if err = decodeResponse(response, &responses); err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
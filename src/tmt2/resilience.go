@@ -0,0 +1,232 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests to TMT2 while the circuit breaker is open
+var ErrCircuitOpen = errors.New("tmt2 circuit breaker is open")
+
+// ResilienceConfig configures deadlines, retries and the circuit breaker of requests to TMT2
+type ResilienceConfig struct {
+	RequestTimeout      time.Duration            // deadline of an operation including retries
+	OperationTimeouts   map[string]time.Duration // deadlines of single operations, e.g. CreateMatch
+	Retries             int                      // retries of idempotent requests on connection errors and 5xx responses
+	RetryBaseDelay      time.Duration
+	RetryMaxDelay       time.Duration
+	BreakerFailures     int // consecutive failed operations which open the circuit breaker
+	BreakerOpenDuration time.Duration
+}
+
+// Circuit breaker states, exposed as metric value
+const (
+	breakerClosed = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+var breakerStateNames = map[int]string{
+	breakerClosed:   "closed",
+	breakerHalfOpen: "half-open",
+	breakerOpen:     "open",
+}
+
+// circuitBreaker opens after consecutive failures and rejects requests for the open duration. Afterwards a single trial
+// request is let through, which closes the breaker on success or opens it again on failure.
+type circuitBreaker struct {
+	name         string // name of the backend
+	mu           sync.Mutex
+	state        int
+	failures     int
+	threshold    int
+	openDuration time.Duration
+	openedAt     time.Time
+}
+
+func newCircuitBreaker(name string, threshold int, openDuration time.Duration) *circuitBreaker {
+	metrics.TMT2CircuitBreakerState.WithLabelValues(name).Set(breakerClosed)
+	return &circuitBreaker{name: name, threshold: threshold, openDuration: openDuration}
+}
+
+// Allow reports whether a request may be made. In the open state after the open duration, the first caller gets the
+// trial request.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// Available reports whether the breaker is closed or a trial request is due, without claiming the trial request
+func (b *circuitBreaker) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == breakerClosed || b.state == breakerOpen && time.Since(b.openedAt) >= b.openDuration
+}
+
+// Record records the result of an allowed request
+func (b *circuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state int) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("TMT2 circuit breaker state changed", "backend", b.name, "from", breakerStateNames[b.state], "to", breakerStateNames[state], "failures", b.failures)
+	b.state = state
+	metrics.TMT2CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
+
+// resilientTransport applies the deadline of the operation, retries idempotent requests with jittered backoff and
+// rejects requests while the circuit breaker is open
+type resilientTransport struct {
+	next    http.RoundTripper
+	config  ResilienceConfig
+	breaker *circuitBreaker
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	operation := operationFromContext(req.Context())
+	timeout, ok := t.config.OperationTimeouts[operation]
+	if !ok {
+		timeout = t.config.RequestTimeout
+	}
+
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	req = req.WithContext(ctx)
+
+	for attempt := 0; ; attempt++ {
+		response, err := t.next.RoundTrip(req)
+		failed := err != nil || response.StatusCode >= http.StatusInternalServerError
+
+		if !failed || attempt >= t.config.Retries || !isIdempotent(req) || ctx.Err() != nil {
+			t.breaker.Record(!failed)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// the deadline has to last until the caller read the body
+			response.Body = &cancelOnCloseBody{ReadCloser: response.Body, cancel: cancel}
+			return response, nil
+		}
+
+		if response != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+
+		if req, err = rewindRequest(req); err != nil {
+			t.breaker.Record(false)
+			cancel()
+			return nil, err
+		}
+
+		delay := t.backoff(attempt)
+		slog.Debug("Retrying TMT2 request", "operation", operation, "attempt", attempt+1, "delay", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			t.breaker.Record(false)
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns a random delay up to the exponential backoff of the attempt (full jitter)
+func (t *resilientTransport) backoff(attempt int) time.Duration {
+	maxDelay := t.config.RetryBaseDelay << attempt
+	if maxDelay <= 0 || maxDelay > t.config.RetryMaxDelay {
+		maxDelay = t.config.RetryMaxDelay
+	}
+	if maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(maxDelay)))
+}
+
+// isIdempotent reports whether the request may be sent again without changing the result
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	default:
+		return false
+	}
+}
+
+// rewindRequest returns a copy of the request with a fresh body for a retry
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, nil
+}
+
+// cancelOnCloseBody cancels the context of the request when the response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Available reports whether requests to TMT2 are currently possible, i.e. the client is connected and the circuit
+// breaker is not open
+func (t *TMT2ClientImpl) Available() bool {
+	return t.connected.Load() && t.breaker.Available()
+}
@@ -0,0 +1,185 @@
+package tmt2
+
+import (
+	"context"
+	"errors"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/tmt2/tmt2test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testBreakerOpenDuration = 50 * time.Millisecond
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker("test", 2, testBreakerOpenDuration)
+
+	expectState := func(state int, available bool) {
+		t.Helper()
+		if breaker.state != state || breaker.Available() != available {
+			t.Fatalf("state = %s, available = %t, want %s, %t", breakerStateNames[breaker.state], breaker.Available(), breakerStateNames[state], available)
+		}
+	}
+
+	// closed until the threshold of consecutive failures is reached
+	breaker.Record(false)
+	breaker.Record(true)
+	breaker.Record(false)
+	expectState(breakerClosed, true)
+	breaker.Record(false)
+	expectState(breakerOpen, false)
+	if breaker.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	// a single trial request after the open duration, which opens the breaker again on failure
+	time.Sleep(testBreakerOpenDuration)
+	expectState(breakerOpen, true)
+	if !breaker.Allow() {
+		t.Fatal("breaker did not allow the trial request")
+	}
+	expectState(breakerHalfOpen, false)
+	if breaker.Allow() {
+		t.Fatal("half-open breaker allowed a second request")
+	}
+	breaker.Record(false)
+	expectState(breakerOpen, false)
+
+	// a successful trial request closes the breaker
+	time.Sleep(testBreakerOpenDuration)
+	if !breaker.Allow() {
+		t.Fatal("breaker did not allow the trial request")
+	}
+	breaker.Record(true)
+	expectState(breakerClosed, true)
+}
+
+// countingTransport counts the requests per method
+type countingTransport struct {
+	next     http.RoundTripper
+	requests map[string]*atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests[req.Method].Add(1)
+	return c.next.RoundTrip(req)
+}
+
+func TestResilientTransportRetries(t *testing.T) {
+	fake := tmt2test.NewServer(testAccessToken)
+	defer fake.Close()
+	fake.SetUnavailable(true)
+
+	tests := []struct {
+		method       string
+		wantAttempts int32
+	}{
+		{method: http.MethodGet, wantAttempts: 3},
+		{method: http.MethodDelete, wantAttempts: 3},
+		{method: http.MethodPut, wantAttempts: 3},
+		{method: http.MethodPost, wantAttempts: 1},
+		{method: http.MethodPatch, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			counter := &countingTransport{next: http.DefaultTransport, requests: map[string]*atomic.Int32{tt.method: {}}}
+			transport := &resilientTransport{
+				next:    counter,
+				config:  ResilienceConfig{Retries: 2, RetryBaseDelay: time.Millisecond, RetryMaxDelay: time.Millisecond},
+				breaker: newCircuitBreaker("test", 0, testBreakerOpenDuration),
+			}
+
+			request, err := http.NewRequest(tt.method, fake.URL+"/api/matches", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := transport.RoundTrip(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+			}
+			if attempts := counter.requests[tt.method].Load(); attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestResilientTransportOperationTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	transport := &resilientTransport{
+		next:    http.DefaultTransport,
+		config:  ResilienceConfig{RequestTimeout: time.Second, OperationTimeouts: map[string]time.Duration{"GetMatch": 20 * time.Millisecond}},
+		breaker: newCircuitBreaker("test", 0, testBreakerOpenDuration),
+	}
+
+	tests := []struct {
+		operation string
+		wantErr   error
+	}{
+		{operation: "GetMatch", wantErr: context.DeadlineExceeded},
+		{operation: "GetAllMatches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			request, err := http.NewRequestWithContext(withOperation(context.Background(), tt.operation), http.MethodGet, slow.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := transport.RoundTrip(request)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RoundTrip() error = %v, want %v", err, tt.wantErr)
+			}
+			if response != nil {
+				response.Body.Close()
+			}
+		})
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	fake := tmt2test.NewServer(testAccessToken)
+	defer fake.Close()
+	client := newTestClient(t, fake, ResilienceConfig{BreakerFailures: 2, BreakerOpenDuration: testBreakerOpenDuration})
+
+	fake.SetUnavailable(true)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetMatchDetails(ctx, "match1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("GetMatchDetails() error = %v, want the error of TMT2", err)
+		}
+	}
+	if client.Available() {
+		t.Fatal("client available after the breaker opened")
+	}
+	if _, err := client.GetMatchDetails(ctx, "match1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GetMatchDetails() error = %v, want ErrCircuitOpen", err)
+	}
+
+	// TMT2 recovered, the trial request closes the breaker. Not found is an answer of a working TMT2.
+	fake.SetUnavailable(false)
+	time.Sleep(testBreakerOpenDuration)
+	if !client.Available() {
+		t.Fatal("client not available for the trial request")
+	}
+	if _, err := client.GetMatchDetails(ctx, "match1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetMatchDetails() error = %v, want ErrNotFound", err)
+	}
+	if !client.Available() {
+		t.Error("client not available after the successful trial request")
+	}
+}
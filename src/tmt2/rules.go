@@ -0,0 +1,114 @@
+package tmt2
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// TemplateRule selects a match template for all matches matching the rule. Empty fields match every match.
+type TemplateRule struct {
+	TournamentName string `json:"tournamentName,omitempty"` // regular expression for MatchInfo.TournamentName
+	MatchTitle     string `json:"matchTitle,omitempty"`     // regular expression for MatchInfo.MatchTitle
+	Game           string `json:"game,omitempty"`
+	PlayerAmount   uint   `json:"playerAmount,omitempty"`
+	NumberOfMaps   int    `json:"numberOfMaps,omitempty"`
+	Template       string `json:"template"` // name of the template without file extension
+}
+
+// TemplateRules is an ordered list of rules, the first matching rule wins
+type TemplateRules []TemplateRule
+
+func (r TemplateRule) matches(matchInfo *matchservice.MatchInfo) (bool, error) {
+	if r.Game != "" && !strings.EqualFold(r.Game, matchInfo.Game) {
+		return false, nil
+	}
+	if r.PlayerAmount > 0 && r.PlayerAmount != matchInfo.PlayerAmount {
+		return false, nil
+	}
+	if r.NumberOfMaps > 0 && r.NumberOfMaps != matchInfo.NumberOfMaps {
+		return false, nil
+	}
+
+	for _, expression := range [][2]string{{r.TournamentName, matchInfo.TournamentName}, {r.MatchTitle, matchInfo.MatchTitle}} {
+		if expression[0] == "" {
+			continue
+		}
+		matched, err := regexp.MatchString(expression[0], expression[1])
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// templateRules returns the currently configured template rules, which are read from the config templates
+func (t *TMT2ClientImpl) templateRules() (TemplateRules, error) {
+	if t.templateRulesName == "" {
+		return nil, nil
+	}
+
+	rulesText, ok := t.config.GetConfig().Templates[t.templateRulesName]
+	if !ok {
+		return nil, fmt.Errorf("template rules %s not found", t.templateRulesName)
+	}
+
+	var rules TemplateRules
+	if err := json.Unmarshal([]byte(rulesText), &rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// validateTemplateRules checks that the rules can be parsed and every referenced template exists
+func (t *TMT2ClientImpl) validateTemplateRules() error {
+	rules, err := t.templateRules()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if _, ok := t.MatchTemplate(rule.Template); !ok {
+			return fmt.Errorf("template %s of template rule not found", rule.Template)
+		}
+		for _, expression := range []string{rule.TournamentName, rule.MatchTitle} {
+			if _, err = regexp.Compile(expression); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SelectMatchTemplate returns the name of the template of the first matching template rule, or the default match
+// template if no rule matches. If matches are created from a preset, no template is used and an empty name is returned.
+func (t *TMT2ClientImpl) SelectMatchTemplate(matchInfo *matchservice.MatchInfo) string {
+	if t.matchPresetName != "" {
+		return ""
+	}
+
+	rules, err := t.templateRules()
+	if err != nil {
+		slog.Error("Error loading template rules, using default template", "err", err)
+		return t.matchTemplateName
+	}
+
+	for _, rule := range rules {
+		matched, err := rule.matches(matchInfo)
+		if err != nil {
+			slog.Error("Error evaluating template rule", "rule", rule, "err", err)
+			continue
+		}
+		if matched {
+			return rule.Template
+		}
+	}
+
+	return t.matchTemplateName
+}
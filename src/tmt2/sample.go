@@ -0,0 +1,32 @@
+package tmt2
+
+import "github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+
+// SampleMatchInfo is used to render templates without a real match, e.g. for testing or syncing presets
+var SampleMatchInfo = matchservice.MatchInfo{
+	Id:   "test",
+	MsID: "abc123",
+	Team1: matchservice.Team{
+		Id:    "def456",
+		Name:  "Team1",
+		Ready: true,
+	},
+	Team2: matchservice.Team{
+		Id:    "ghi789",
+		Name:  "Team2",
+		Ready: true,
+	},
+	PlayerAmount:       4,
+	Game:               "cs2",
+	Map:                "de_dust2",
+	ServerAddress:      "127.0.0.1:27015",
+	ServerPassword:     "password",
+	ServerPasswordMgmt: "rootpassword",
+	ServerTvAddress:    "",
+	ServerTvPassword:   "",
+	TournamentName:     "nicematch",
+	MatchTitle:         "Team1 vs Team2",
+	MapList:            []string{"de_ancient", "de_anubis", "de_dust2", "de_inferno", "de_mirage", "de_nuke", "de_vertigo"},
+	NumberOfMaps:       1,
+	Ready:              true,
+}
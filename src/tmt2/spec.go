@@ -0,0 +1,252 @@
+package tmt2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StageSpec is the stage of parsing and assembling a match spec in which a template error can occur
+const StageSpec = "spec"
+
+// Series formats of a match spec
+const (
+	SeriesBo1 = "bo1"
+	SeriesBo3 = "bo3"
+	SeriesBo5 = "bo5"
+)
+
+// Side modes of a match spec
+const (
+	SideModeKnife  = "knife"
+	SideModeRandom = "random"
+	SideModePick   = "pick"
+)
+
+// specSuffixes are the file extensions of match specs in the config templates. JSON is valid YAML, so both are
+// parsed the same way.
+var specSuffixes = []string{".yaml", ".yml", ".json"}
+
+// MatchSpec is a declarative description of TMT2 matches and an alternative to match templates. It is assembled into
+// a match create dto in Go, teams, game server and passthrough are taken from the match info.
+type MatchSpec struct {
+	MapPool        []string         `yaml:"mapPool"`        // maps to pick and ban, defaults to MatchInfo.MapList
+	Series         string           `yaml:"series"`         // bo1, bo3 or bo5, defaults to the number of maps of the match info
+	SideMode       string           `yaml:"sideMode"`       // knife, random or pick, defaults to knife
+	CanClinch      *bool            `yaml:"canClinch"`      // defaults to true in TMT2
+	MatchEndAction string           `yaml:"matchEndAction"` // NONE, KICK_ALL or QUIT_SERVER
+	Mode           string           `yaml:"mode"`           // SINGLE or LOOP
+	WebhookURL     string           `yaml:"webhookUrl"`
+	TmtLogAddress  string           `yaml:"tmtLogAddress"`
+	RconCommands   MatchSpecCommand `yaml:"rconCommands"`
+}
+
+// MatchSpecCommand are the rcon commands TMT2 executes during the match
+type MatchSpecCommand struct {
+	Init  []string `yaml:"init"`
+	Knife []string `yaml:"knife"`
+	Match []string `yaml:"match"`
+	End   []string `yaml:"end"`
+}
+
+// yamlErrorLine matches the line of yaml errors, e.g. "line 3: field foo not found in type tmt2.MatchSpec"
+var yamlErrorLine = regexp.MustCompile(`line (\d+): (.*)$`)
+
+// ParseMatchSpec parses a YAML or JSON match spec. Unknown fields are rejected to catch typos.
+func ParseMatchSpec(text string) (*MatchSpec, []TemplateError) {
+	decoder := yaml.NewDecoder(strings.NewReader(text))
+	decoder.KnownFields(true)
+
+	var spec MatchSpec
+	err := decoder.Decode(&spec)
+	if err == nil {
+		return &spec, nil
+	}
+
+	var messages []string
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		messages = typeError.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	templateErrors := make([]TemplateError, 0, len(messages))
+	for _, message := range messages {
+		templateError := TemplateError{Stage: StageSpec, Message: message}
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			templateError.Line, _ = strconv.Atoi(match[1])
+			templateError.Position = PositionTemplate
+			templateError.Message = match[2]
+		}
+		templateErrors = append(templateErrors, templateError)
+	}
+	return nil, templateErrors
+}
+
+// Build assembles the match create dto from the spec and the match info
+func (s *MatchSpec) Build(externalID string, matchInfo *matchservice.MatchInfo) (*tmt2_go.IMatchCreateDto, error) {
+	if matchInfo == nil {
+		return nil, errors.New("empty matchinfo")
+	}
+
+	mapPool := s.MapPool
+	if len(mapPool) == 0 {
+		mapPool = matchInfo.MapList
+	}
+
+	electionSteps, err := s.electionSteps(len(mapPool), matchInfo.NumberOfMaps)
+	if err != nil {
+		return nil, err
+	}
+
+	createMatchDto := tmt2_go.IMatchCreateDto{
+		CanClinch:     s.CanClinch,
+		ElectionSteps: electionSteps,
+		MapPool:       mapPool,
+	}
+	if s.MatchEndAction != "" {
+		matchEndAction := tmt2_go.TMatchEndAction(s.MatchEndAction)
+		createMatchDto.MatchEndAction = &matchEndAction
+	}
+	if s.Mode != "" {
+		mode := tmt2_go.TMatchMode(s.Mode)
+		createMatchDto.Mode = &mode
+	}
+	if s.WebhookURL != "" {
+		createMatchDto.WebhookUrl = &s.WebhookURL
+	}
+	if s.TmtLogAddress != "" {
+		createMatchDto.TmtLogAddress = &s.TmtLogAddress
+	}
+	createMatchDto.RconCommands = s.rconCommands()
+
+	return applyMatchInfo(createMatchDto, externalID, matchInfo)
+}
+
+func (s *MatchSpec) rconCommands() *struct {
+	End   *[]string `json:"end,omitempty"`
+	Init  *[]string `json:"init,omitempty"`
+	Knife *[]string `json:"knife,omitempty"`
+	Match *[]string `json:"match,omitempty"`
+} {
+	commands := s.RconCommands
+	if commands.Init == nil && commands.Knife == nil && commands.Match == nil && commands.End == nil {
+		return nil
+	}
+
+	rconCommands := &struct {
+		End   *[]string `json:"end,omitempty"`
+		Init  *[]string `json:"init,omitempty"`
+		Knife *[]string `json:"knife,omitempty"`
+		Match *[]string `json:"match,omitempty"`
+	}{}
+	if commands.Init != nil {
+		rconCommands.Init = &commands.Init
+	}
+	if commands.Knife != nil {
+		rconCommands.Knife = &commands.Knife
+	}
+	if commands.Match != nil {
+		rconCommands.Match = &commands.Match
+	}
+	if commands.End != nil {
+		rconCommands.End = &commands.End
+	}
+	return rconCommands
+}
+
+// seriesMaps returns the number of maps played in the series
+func (s *MatchSpec) seriesMaps(numberOfMaps int) (int, error) {
+	switch s.Series {
+	case SeriesBo1:
+		return 1, nil
+	case SeriesBo3:
+		return 3, nil
+	case SeriesBo5:
+		return 5, nil
+	case "":
+		if numberOfMaps == 3 || numberOfMaps == 5 {
+			return numberOfMaps, nil
+		}
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("unknown series %q", s.Series)
+	}
+}
+
+// electionSteps returns the veto of the series: two bans, the picks of the teams, the remaining bans and the decider
+// on the last remaining map. The teams alternate, starting with team A.
+func (s *MatchSpec) electionSteps(mapPoolSize, numberOfMaps int) ([]tmt2_go.IMatchCreateDto_ElectionSteps_Item, error) {
+	maps, err := s.seriesMaps(numberOfMaps)
+	if err != nil {
+		return nil, err
+	}
+	if mapPoolSize < maps {
+		return nil, fmt.Errorf("map pool has %d maps, but a best of %d requires at least %d", mapPoolSize, maps, maps)
+	}
+
+	pickSide, deciderSide, err := s.sides()
+	if err != nil {
+		return nil, err
+	}
+
+	bans := mapPoolSize - maps
+	bansBeforePicks := min(2, bans)
+	teams := [2]tmt2_go.TWho{tmt2_go.TWhoTEAMA, tmt2_go.TWhoTEAMB}
+
+	var steps []tmt2_go.IMatchCreateDto_ElectionSteps_Item
+	for i := 0; i < bansBeforePicks; i++ {
+		steps = append(steps, tmt2_go.SkipStep(tmt2_go.BanMap(teams[i%2])))
+	}
+	for i := 0; i < maps-1; i++ {
+		steps = append(steps, tmt2_go.AddStep(tmt2_go.PickMap(teams[i%2]), pickSide(teams[(i+1)%2])))
+	}
+	for i := bansBeforePicks; i < bans; i++ {
+		steps = append(steps, tmt2_go.SkipStep(tmt2_go.BanMap(teams[i%2])))
+	}
+	steps = append(steps, tmt2_go.AddStep(tmt2_go.RandomMap(), deciderSide))
+
+	return steps, nil
+}
+
+// sides returns the side selection of picked maps, which gets the opponent of the picking team, and of the decider
+func (s *MatchSpec) sides() (func(opponent tmt2_go.TWho) tmt2_go.IElectionStepAdd_Side, tmt2_go.IElectionStepAdd_Side, error) {
+	switch s.SideMode {
+	case SideModeKnife, "":
+		return func(tmt2_go.TWho) tmt2_go.IElectionStepAdd_Side { return tmt2_go.KnifeSide() }, tmt2_go.KnifeSide(), nil
+	case SideModeRandom:
+		return func(tmt2_go.TWho) tmt2_go.IElectionStepAdd_Side { return tmt2_go.RandomSide() }, tmt2_go.RandomSide(), nil
+	case SideModePick:
+		return tmt2_go.PickSide, tmt2_go.KnifeSide(), nil
+	default:
+		return nil, tmt2_go.IElectionStepAdd_Side{}, fmt.Errorf("unknown side mode %q", s.SideMode)
+	}
+}
+
+// renderMatchSpec parses the spec and assembles it with the match info into the json of a match create dto, which is
+// validated like a rendered match template
+func renderMatchSpec(text, externalID string, matchInfo *matchservice.MatchInfo) (json.RawMessage, []TemplateError) {
+	spec, templateErrors := ParseMatchSpec(text)
+	if len(templateErrors) > 0 {
+		return nil, templateErrors
+	}
+
+	createMatchDto, err := spec.Build(externalID, matchInfo)
+	if err != nil {
+		return nil, []TemplateError{{Stage: StageSpec, Message: err.Error()}}
+	}
+
+	rendered, err := json.Marshal(createMatchDto)
+	if err != nil {
+		return nil, []TemplateError{{Stage: StageSpec, Message: err.Error()}}
+	}
+
+	return rendered, validateRendered(string(rendered))
+}
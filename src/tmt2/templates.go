@@ -0,0 +1,158 @@
+package tmt2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_tmt2/src/metrics"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// MatchTemplateSource is the text of a match template or a match spec
+type MatchTemplateSource struct {
+	Text string
+	Spec bool // the text is a MatchSpec instead of a go template
+}
+
+// Render renders the template or assembles the spec with the match info into the json of a match create dto and
+// validates it. Templates have to set the passthrough on their own, specs use the externalID.
+func (s MatchTemplateSource) Render(externalID string, matchInfo *matchservice.MatchInfo) (json.RawMessage, []TemplateError) {
+	if s.Spec {
+		return renderMatchSpec(s.Text, externalID, matchInfo)
+	}
+	return renderMatchTemplate(s.Text, matchInfo)
+}
+
+// templateVersion is a validated version of a match template
+type templateVersion struct {
+	MatchTemplateSource
+	Version  string // first 12 hex characters of the sha256 of the text
+	ActiveAt time.Time
+}
+
+// templateStore holds the last-known-good version of every match template
+type templateStore struct {
+	mu       sync.Mutex
+	active   map[string]templateVersion
+	rejected map[string]string // version of the last rejected text per template, so it is only reported once
+}
+
+func newTemplateStore() *templateStore {
+	return &templateStore{
+		active:   make(map[string]templateVersion),
+		rejected: make(map[string]string),
+	}
+}
+
+func templateTextVersion(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// matchTemplateNames returns the names of the default match template and all templates of the template rules
+func (t *TMT2ClientImpl) matchTemplateNames() []string {
+	names := []string{t.matchTemplateName}
+
+	rules, err := t.templateRules()
+	if err != nil {
+		slog.Error("Error loading template rules", "err", err)
+		return names
+	}
+
+	for _, rule := range rules {
+		names = append(names, rule.Template)
+	}
+	return names
+}
+
+// ReloadTemplates validates all changed match templates of the config by rendering them with the sample match info.
+// Valid templates become active, invalid templates are rejected and their last-known-good version stays active.
+func (t *TMT2ClientImpl) ReloadTemplates() error {
+	if t.matchPresetName != "" {
+		return nil
+	}
+
+	var errs []error
+	for _, name := range t.matchTemplateNames() {
+		if _, err := t.activeTemplate(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// activeTemplate returns the active version of the template. If the configured text changed, it is validated first
+// and activated if valid. An error is only returned if there is no valid version of the template at all.
+func (t *TMT2ClientImpl) activeTemplate(name string) (MatchTemplateSource, error) {
+	t.templates.mu.Lock()
+	defer t.templates.mu.Unlock()
+
+	active, hasActive := t.templates.active[name]
+
+	source, ok := t.MatchTemplate(name)
+	if !ok {
+		if hasActive {
+			return active.MatchTemplateSource, nil
+		}
+		return MatchTemplateSource{}, fmt.Errorf("template %s not found", name)
+	}
+
+	version := templateTextVersion(source.Text)
+	if hasActive && active.Version == version {
+		return active.MatchTemplateSource, nil
+	}
+	if t.templates.rejected[name] == version {
+		if hasActive {
+			return active.MatchTemplateSource, nil
+		}
+		return MatchTemplateSource{}, fmt.Errorf("template %s version %s is invalid", name, version)
+	}
+
+	sampleMatchInfo := SampleMatchInfo
+	if _, templateErrors := source.Render(sampleMatchInfo.Id, &sampleMatchInfo); len(templateErrors) > 0 {
+		t.templates.rejected[name] = version
+		metrics.TemplateReloads.WithLabelValues(name, metrics.TemplateReloadRejected).Inc()
+
+		if hasActive {
+			slog.Error("Rejected invalid template, keeping last known good version", "template", name, "version", version, "activeVersion", active.Version, "errors", templateErrors)
+			return active.MatchTemplateSource, nil
+		}
+		slog.Error("Rejected invalid template, no valid version available", "template", name, "version", version, "errors", templateErrors)
+		return MatchTemplateSource{}, fmt.Errorf("template %s version %s is invalid: %w", name, version, templateErrors[0])
+	}
+
+	delete(t.templates.rejected, name)
+	t.templates.active[name] = templateVersion{MatchTemplateSource: source, Version: version, ActiveAt: time.Now()}
+	metrics.TemplateReloads.WithLabelValues(name, metrics.TemplateReloadAccepted).Inc()
+	if hasActive {
+		metrics.ActiveTemplate.DeleteLabelValues(name, active.Version)
+	}
+	metrics.ActiveTemplate.WithLabelValues(name, version).Set(1)
+	slog.Info("Activated template", "template", name, "version", version, "previousVersion", active.Version)
+
+	return source, nil
+}
+
+// StartTemplateReload reloads the match templates periodically, so changes are validated and reported before they
+// are used
+func (t *TMT2ClientImpl) StartTemplateReload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.ReloadTemplates(); err != nil {
+				slog.Error("Error reloading templates", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
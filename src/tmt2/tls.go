@@ -0,0 +1,94 @@
+package tmt2
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ErrFingerprintMismatch is returned if the certificate of TMT2 does not match any pinned fingerprint
+var ErrFingerprintMismatch = errors.New("tmt2 certificate does not match a pinned fingerprint")
+
+// TLSConfig configures the verification of the TMT2 certificate and the client certificate for mTLS
+type TLSConfig struct {
+	CAFile       string   // PEM bundle of CAs trusted in addition to the system roots
+	CertFile     string   // PEM client certificate for mTLS
+	KeyFile      string   // PEM key of the client certificate
+	Fingerprints []string // hex encoded SHA-256 fingerprints of accepted TMT2 certificates, colons are ignored
+	Insecure     bool     // skip the verification of the certificate chain and host name
+}
+
+// Build returns the tls config of the http transport to TMT2
+func (c TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tmt2 ca bundle: %w", err)
+		}
+
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			slog.Warn("Error loading system certificate pool, only the tmt2 ca bundle is trusted", "error", err)
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tmt2 ca bundle %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tmt2 client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(c.Fingerprints) > 0 {
+		fingerprints := make(map[string]bool, len(c.Fingerprints))
+		for _, fingerprint := range c.Fingerprints {
+			normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+			if decoded, err := hex.DecodeString(normalized); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid tmt2 certificate fingerprint %q, expected a hex encoded SHA-256 hash", fingerprint)
+			}
+			fingerprints[normalized] = true
+		}
+		tlsConfig.VerifyPeerCertificate = verifyFingerprint(fingerprints)
+	}
+
+	if c.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+		if len(c.Fingerprints) > 0 {
+			slog.Warn("TLS verification of TMT2 is disabled, only the pinned certificate fingerprints are checked")
+		} else {
+			slog.Warn("TLS verification of TMT2 is disabled, the admin token can be intercepted on the network")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyFingerprint returns a check that the leaf certificate presented by TMT2 has one of the fingerprints. It runs
+// after the regular verification, or instead of it in insecure mode.
+func verifyFingerprint(fingerprints map[string]bool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrFingerprintMismatch
+		}
+
+		sum := sha256.Sum256(rawCerts[0])
+		if !fingerprints[hex.EncodeToString(sum[:])] {
+			return fmt.Errorf("%w: %s", ErrFingerprintMismatch, hex.EncodeToString(sum[:]))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package tmt2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes the pem block to a file in the test directory and returns its path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fingerprint returns the colon separated upper case SHA-256 fingerprint of the certificate, as shown by openssl
+func fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+	parts := make([]string, 0, len(encoded)/2)
+	for i := 0; i < len(encoded); i += 2 {
+		parts = append(parts, encoded[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// get requests the url with the tls config built from the config
+func get(t *testing.T, config TLSConfig, url string) error {
+	t.Helper()
+	tlsConfig, err := config.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func TestTLSConfigVerifiesServer(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	serverFingerprint := fingerprint(server.Certificate())
+	otherFingerprint := strings.Repeat("ab", sha256.Size)
+
+	tests := []struct {
+		name     string
+		config   TLSConfig
+		wantErr  bool
+		mismatch bool
+	}{
+		{name: "untrusted", config: TLSConfig{}, wantErr: true},
+		{name: "trusted ca", config: TLSConfig{CAFile: caFile}},
+		{name: "trusted ca and pinned", config: TLSConfig{CAFile: caFile, Fingerprints: []string{otherFingerprint, serverFingerprint}}},
+		{name: "trusted ca and other pinned", config: TLSConfig{CAFile: caFile, Fingerprints: []string{otherFingerprint}}, wantErr: true, mismatch: true},
+		{name: "insecure", config: TLSConfig{Insecure: true}},
+		{name: "insecure and pinned", config: TLSConfig{Insecure: true, Fingerprints: []string{serverFingerprint}}},
+		{name: "insecure and pinned lower case", config: TLSConfig{Insecure: true, Fingerprints: []string{strings.ToLower(strings.ReplaceAll(serverFingerprint, ":", ""))}}},
+		{name: "insecure and other pinned", config: TLSConfig{Insecure: true, Fingerprints: []string{otherFingerprint}}, wantErr: true, mismatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := get(t, tt.config, server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("request error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.mismatch && !errors.Is(err, ErrFingerprintMismatch) {
+				t.Errorf("request error = %v, want ErrFingerprintMismatch", err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "unwindia-tmt2"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCertificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, "client.pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCertificate)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	if err = get(t, TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, server.URL); err != nil {
+		t.Errorf("request with client certificate error = %v", err)
+	}
+	if err = get(t, TLSConfig{CAFile: caFile}, server.URL); err == nil {
+		t.Error("request without client certificate error = nil")
+	}
+}
+
+func TestTLSConfigBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyFile, []byte("no certificates"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config TLSConfig
+	}{
+		{name: "missing ca bundle", config: TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "ca bundle without certificates", config: TLSConfig{CAFile: emptyFile}},
+		{name: "key without certificate", config: TLSConfig{KeyFile: emptyFile}},
+		{name: "invalid client certificate", config: TLSConfig{CertFile: emptyFile, KeyFile: emptyFile}},
+		{name: "fingerprint not hex", config: TLSConfig{Fingerprints: []string{strings.Repeat("zz", sha256.Size)}}},
+		{name: "fingerprint too short", config: TLSConfig{Fingerprints: []string{"ab:cd"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.config.Build(); err == nil {
+				t.Error("Build() error = nil")
+			}
+		})
+	}
+}
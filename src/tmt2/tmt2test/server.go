@@ -0,0 +1,539 @@
+// Package tmt2test provides an in-memory fake of the TMT2 api for tests, similar to net/http/httptest. It implements
+// the operations used by the service on matches, presets, game servers, rcon and round backups, and sends webhooks.
+package tmt2test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake TMT2 listening on a local address. Requests without the access token are rejected like by TMT2.
+type Server struct {
+	*httptest.Server
+
+	token string
+
+	mu           sync.Mutex
+	nextID       int
+	unavailable  bool
+	matches      map[string]*tmt2_go.IMatchResponse
+	presets      map[string]tmt2_go.IPreset
+	gameServers  []tmt2_go.IManagedGameServer
+	roundBackups map[string][]string // round backup files per game server, latest first
+	rcon         map[string][]string // rcon commands received per match
+	loaded       map[string][]string // round backup files loaded per match
+}
+
+// NewServer starts a fake TMT2 accepting the access token. The caller has to Close it.
+func NewServer(token string) *Server {
+	s := &Server{
+		token:        token,
+		matches:      make(map[string]*tmt2_go.IMatchResponse),
+		presets:      make(map[string]tmt2_go.IPreset),
+		roundBackups: make(map[string][]string),
+		rcon:         make(map[string][]string),
+		loaded:       make(map[string][]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetUnavailable lets all requests fail with 503 Service Unavailable until it is reset, e.g. to test the circuit breaker
+func (s *Server) SetUnavailable(unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unavailable = unavailable
+}
+
+// Match returns a copy of the match
+func (s *Server) Match(id string) (tmt2_go.IMatchResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match, ok := s.matches[id]
+	if !ok {
+		return tmt2_go.IMatchResponse{}, false
+	}
+	return *match, true
+}
+
+// Matches returns copies of all matches
+func (s *Server) Matches() []tmt2_go.IMatchResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := make([]tmt2_go.IMatchResponse, 0, len(s.matches))
+	for _, match := range s.matches {
+		matches = append(matches, *match)
+	}
+	return matches
+}
+
+// StopMatch stops the match as if it was stopped unexpectedly
+func (s *Server) StopMatch(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match, ok := s.matches[id]
+	if !ok {
+		return fmt.Errorf("match %s not found", id)
+	}
+	match.IsStopped = true
+	match.IsLive = false
+	return nil
+}
+
+// Reset removes all matches as if TMT2 lost its storage
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matches = make(map[string]*tmt2_go.IMatchResponse)
+}
+
+// AddGameServer adds a managed game server, which is used for matches created without a game server
+func (s *Server) AddGameServer(gameServer tmt2_go.IManagedGameServer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gameServers = append(s.gameServers, gameServer)
+}
+
+// AddRoundBackup adds a round backup file to the game server of the match. Like TMT2, the file should be named after
+// the match id, e.g. round_backup_match1_round05.txt.
+func (s *Server) AddRoundBackup(matchID, file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match, ok := s.matches[matchID]
+	if !ok {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	key := gameServerKey(match.GameServer)
+	s.roundBackups[key] = append([]string{file}, s.roundBackups[key]...)
+	return nil
+}
+
+// RconCommands returns the rcon commands received for the match
+func (s *Server) RconCommands(matchID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.rcon[matchID])
+}
+
+// LoadedRoundBackups returns the round backup files loaded into the match
+func (s *Server) LoadedRoundBackups(matchID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.loaded[matchID])
+}
+
+// SendEvent posts the event to the webhook url of the match
+func (s *Server) SendEvent(ctx context.Context, matchID string, event any) error {
+	match, ok := s.Match(matchID)
+	if !ok {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	if match.WebhookUrl == nil || *match.WebhookUrl == "" {
+		return fmt.Errorf("match %s has no webhook url", matchID)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, *match.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode > 299 {
+		return fmt.Errorf("webhook failed: %s", response.Status)
+	}
+	return nil
+}
+
+// FinishMatch finishes the match with a win of team A and sends the MATCH_END event to its webhook url
+func (s *Server) FinishMatch(ctx context.Context, matchID string) error {
+	s.mu.Lock()
+	match, ok := s.matches[matchID]
+	if ok {
+		match.State = tmt2_go.TMatchStateFINISHED
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+
+	return s.SendEvent(ctx, matchID, tmt2_go.MatchEndEvent{
+		MatchId:          match.Id,
+		MatchPassthrough: match.Passthrough,
+		Timestamp:        time.Now().UTC().Format(time.RFC3339),
+		Type:             tmt2_go.MATCHEND,
+		WinnerTeam:       &match.TeamA,
+		WonMapsTeamA:     1,
+	})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unavailable {
+		writeError(w, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+	if r.Header.Get("Authorization") != s.token {
+		writeError(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/")
+	route := r.Method + " " + path[0]
+	if len(path) > 1 {
+		route += "/{id}"
+	}
+	if len(path) > 2 {
+		route += "/" + strings.Join(path[2:min(len(path), 4)], "/")
+	}
+	if len(path) > 4 {
+		route += "/{file}"
+	}
+	if path[0] == "gameservers" && len(path) == 3 {
+		route = r.Method + " gameservers/{ip}/{port}"
+	}
+
+	switch route {
+	case "POST login":
+		writeJSON(w, http.StatusOK, true)
+	case "GET debug":
+		writeJSON(w, http.StatusOK, map[string]any{"tmtVersion": "tmt2test", "tmtLogAddress": s.URL, "webSockets": []any{}})
+	case "GET config":
+		writeJSON(w, http.StatusOK, tmt2_go.IConfig{})
+	case "GET matches":
+		s.getMatches(w, r)
+	case "POST matches":
+		s.createMatch(w, r)
+	case "GET matches/{id}":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) { writeJSON(w, http.StatusOK, match) })
+	case "PATCH matches/{id}":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) { s.updateMatch(w, r, match) })
+	case "DELETE matches/{id}":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) {
+			match.IsStopped = true
+			match.IsLive = false
+			writeJSON(w, http.StatusOK, nil)
+		})
+	case "PATCH matches/{id}/revive":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) {
+			match.IsStopped = false
+			match.IsLive = true
+			writeJSON(w, http.StatusOK, nil)
+		})
+	case "POST matches/{id}/server/rcon":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) { s.execRcon(w, r, match) })
+	case "GET matches/{id}/server/round_backups":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) { s.getRoundBackups(w, r, match) })
+	case "POST matches/{id}/server/round_backups/{file}":
+		s.withMatch(w, path[1], func(match *tmt2_go.IMatchResponse) {
+			found := slices.Contains(s.roundBackups[gameServerKey(match.GameServer)], path[4])
+			if found {
+				s.loaded[match.Id] = append(s.loaded[match.Id], path[4])
+			}
+			writeJSON(w, http.StatusOK, found)
+		})
+	case "GET presets":
+		presets := make([]tmt2_go.IPreset, 0, len(s.presets))
+		for _, preset := range s.presets {
+			presets = append(presets, preset)
+		}
+		writeJSON(w, http.StatusOK, presets)
+	case "POST presets":
+		s.createPreset(w, r)
+	case "PUT presets":
+		s.updatePreset(w, r)
+	case "DELETE presets/{id}":
+		delete(s.presets, path[1])
+		writeJSON(w, http.StatusOK, nil)
+	case "GET gameservers":
+		writeJSON(w, http.StatusOK, s.gameServers)
+	case "POST gameservers":
+		s.createGameServer(w, r)
+	case "DELETE gameservers/{ip}/{port}":
+		s.deleteGameServer(w, path)
+	default:
+		writeError(w, http.StatusNotFound, "unknown route "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) withMatch(w http.ResponseWriter, id string, fn func(match *tmt2_go.IMatchResponse)) {
+	match, ok := s.matches[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "match not found")
+		return
+	}
+	fn(match)
+}
+
+func (s *Server) getMatches(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	matches := make([]tmt2_go.IMatchResponse, 0)
+	for _, match := range s.matches {
+		if passthrough := query["passthrough"]; len(passthrough) > 0 && (match.Passthrough == nil || !slices.Contains(passthrough, *match.Passthrough)) {
+			continue
+		}
+		if state := query["state"]; len(state) > 0 && !slices.Contains(state, string(match.State)) {
+			continue
+		}
+		if isLive := query.Get("isLive"); isLive != "" && isLive != strconv.FormatBool(match.IsLive) {
+			continue
+		}
+		if isStopped := query.Get("isStopped"); isStopped != "" && isStopped != strconv.FormatBool(match.IsStopped) {
+			continue
+		}
+		matches = append(matches, *match)
+	}
+
+	slices.SortFunc(matches, func(a, b tmt2_go.IMatchResponse) int { return strings.Compare(a.Id, b.Id) })
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func (s *Server) createMatch(w http.ResponseWriter, r *http.Request) {
+	var createMatchDto tmt2_go.IMatchCreateDto
+	if err := json.NewDecoder(r.Body).Decode(&createMatchDto); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	electionSteps, err := convertElectionSteps(createMatchDto.ElectionSteps)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gameServer, err := s.selectGameServer(createMatchDto.GameServer)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.nextID++
+	match := &tmt2_go.IMatchResponse{
+		CanClinch:     createMatchDto.CanClinch == nil || *createMatchDto.CanClinch,
+		CreatedAt:     float64(time.Now().UnixMilli()),
+		ElectionSteps: electionSteps,
+		GameServer:    gameServer,
+		Id:            fmt.Sprintf("match%d", s.nextID),
+		IsLive:        true,
+		MapPool:       createMatchDto.MapPool,
+		Passthrough:   createMatchDto.Passthrough,
+		State:         tmt2_go.TMatchStateELECTION,
+		TeamA:         team(createMatchDto.TeamA),
+		TeamB:         team(createMatchDto.TeamB),
+		TmtLogAddress: createMatchDto.TmtLogAddress,
+		TmtSecret:     fmt.Sprintf("secret%d", s.nextID),
+		WebhookUrl:    createMatchDto.WebhookUrl,
+	}
+	if createMatchDto.MatchEndAction != nil {
+		match.MatchEndAction = *createMatchDto.MatchEndAction
+	}
+	if createMatchDto.Mode != nil {
+		match.Mode = *createMatchDto.Mode
+	}
+	if rconCommands := createMatchDto.RconCommands; rconCommands != nil {
+		match.RconCommands.Init = commands(rconCommands.Init)
+		match.RconCommands.Knife = commands(rconCommands.Knife)
+		match.RconCommands.Match = commands(rconCommands.Match)
+		match.RconCommands.End = commands(rconCommands.End)
+	}
+	s.matches[match.Id] = match
+
+	writeJSON(w, http.StatusCreated, match)
+}
+
+// selectGameServer returns the game server of the match or the first free managed game server
+func (s *Server) selectGameServer(gameServer *tmt2_go.IGameServer) (tmt2_go.IGameServer, error) {
+	if gameServer != nil {
+		return *gameServer, nil
+	}
+
+	for _, managed := range s.gameServers {
+		if managed.CanBeUsed && managed.UsedBy == nil {
+			return tmt2_go.IGameServer{Ip: managed.Ip, Port: managed.Port, RconPassword: managed.RconPassword}, nil
+		}
+	}
+	return tmt2_go.IGameServer{}, errors.New("no free game server available")
+}
+
+func (s *Server) updateMatch(w http.ResponseWriter, r *http.Request, match *tmt2_go.IMatchResponse) {
+	var update tmt2_go.IMatchUpdateDto
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if update.CanClinch != nil {
+		match.CanClinch = *update.CanClinch
+	}
+	if update.CurrentMap != nil {
+		match.CurrentMap = *update.CurrentMap
+	}
+	if update.GameServer != nil {
+		match.GameServer = *update.GameServer
+	}
+	if update.MapPool != nil {
+		match.MapPool = *update.MapPool
+	}
+	if update.Mode != nil {
+		match.Mode = *update.Mode
+	}
+	if update.Passthrough != nil {
+		match.Passthrough = update.Passthrough
+	}
+	if update.State != nil {
+		match.State = *update.State
+	}
+
+	writeJSON(w, http.StatusOK, nil)
+}
+
+func (s *Server) execRcon(w http.ResponseWriter, r *http.Request, match *tmt2_go.IMatchResponse) {
+	var commands []string
+	if err := json.NewDecoder(r.Body).Decode(&commands); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.rcon[match.Id] = append(s.rcon[match.Id], commands...)
+	writeJSON(w, http.StatusOK, make([]string, len(commands)))
+}
+
+// getRoundBackups lists the round backups of the game server, which includes those of earlier matches on it
+func (s *Server) getRoundBackups(w http.ResponseWriter, r *http.Request, match *tmt2_go.IMatchResponse) {
+	files := s.roundBackups[gameServerKey(match.GameServer)]
+	latestFiles := files
+	if count, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && count > 0 && count < len(files) {
+		latestFiles = files[:count]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"latestFiles": append([]string{}, latestFiles...), "total": len(files)})
+}
+
+func (s *Server) createPreset(w http.ResponseWriter, r *http.Request) {
+	var presetCreateDto tmt2_go.IPresetCreateDto
+	if err := json.NewDecoder(r.Body).Decode(&presetCreateDto); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.nextID++
+	preset := tmt2_go.IPreset{Id: fmt.Sprintf("preset%d", s.nextID), Name: presetCreateDto.Name, Data: presetCreateDto.Data}
+	s.presets[preset.Id] = preset
+
+	writeJSON(w, http.StatusCreated, preset)
+}
+
+func (s *Server) updatePreset(w http.ResponseWriter, r *http.Request) {
+	var preset tmt2_go.IPreset
+	if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, ok := s.presets[preset.Id]; !ok {
+		writeError(w, http.StatusNotFound, "preset not found")
+		return
+	}
+	s.presets[preset.Id] = preset
+
+	writeJSON(w, http.StatusOK, nil)
+}
+
+func (s *Server) createGameServer(w http.ResponseWriter, r *http.Request) {
+	var gameServer tmt2_go.IManagedGameServer
+	if err := json.NewDecoder(r.Body).Decode(&gameServer); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.gameServers = append(s.gameServers, gameServer)
+	writeJSON(w, http.StatusOK, gameServer)
+}
+
+func (s *Server) deleteGameServer(w http.ResponseWriter, path []string) {
+	if len(path) < 3 {
+		writeError(w, http.StatusNotFound, "game server not found")
+		return
+	}
+
+	port, err := strconv.ParseFloat(path[2], 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.gameServers = slices.DeleteFunc(s.gameServers, func(gameServer tmt2_go.IManagedGameServer) bool {
+		return gameServer.Ip == path[1] && gameServer.Port == port
+	})
+	writeJSON(w, http.StatusOK, nil)
+}
+
+// convertElectionSteps converts the election steps of the create dto into the election steps of the match, which
+// have the same json
+func convertElectionSteps(items []tmt2_go.IMatchCreateDto_ElectionSteps_Item) ([]tmt2_go.IElectionStep, error) {
+	body, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var electionSteps []tmt2_go.IElectionStep
+	err = json.Unmarshal(body, &electionSteps)
+	return electionSteps, err
+}
+
+func team(teamCreateDto tmt2_go.ITeamCreateDto) tmt2_go.ITeam {
+	team := tmt2_go.ITeam{Name: teamCreateDto.Name, Passthrough: teamCreateDto.Passthrough}
+	if teamCreateDto.Advantage != nil {
+		team.Advantage = *teamCreateDto.Advantage
+	}
+	return team
+}
+
+func commands(commands *[]string) []string {
+	if commands == nil {
+		return nil
+	}
+	return slices.Clone(*commands)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func gameServerKey(gameServer tmt2_go.IGameServer) string {
+	return gameServer.Ip + ":" + strconv.Itoa(int(gameServer.Port))
+}
@@ -0,0 +1,264 @@
+package tmt2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"github.com/GSH-LAN/Unwindia_common/src/go/template"
+	tmt2_go "github.com/GSH-LAN/Unwindia_tmt2/pkg/tmt2-go"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	gotemplate "text/template"
+)
+
+// Stages of rendering a match template in which a template error can occur
+const (
+	StageParse      = "parse"
+	StageExecute    = "execute"
+	StageJSON       = "json"
+	StageValidation = "validation"
+)
+
+// Sources a line and column of a template error refer to
+const (
+	PositionTemplate = "template" // the template or match spec text
+	PositionRendered = "rendered" // the json rendered from the template
+)
+
+// TemplateError describes a problem of a match template. For parse, execute and spec errors line and column refer to
+// the template, for json errors to the rendered json, which is named by Position. The rendered json around the error
+// is included as excerpt to find the template part which produced it. Validation errors name the json path of the
+// invalid field.
+type TemplateError struct {
+	Stage    string `json:"stage"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Position string `json:"position,omitempty"`
+	Excerpt  string `json:"excerpt,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+func (e TemplateError) Error() string {
+	switch {
+	case e.Path != "":
+		return fmt.Sprintf("%s: %s: %s", e.Stage, e.Path, e.Message)
+	case e.Position == PositionRendered:
+		return fmt.Sprintf("%s: rendered json %d:%d: %s", e.Stage, e.Line, e.Column, e.Message)
+	case e.Column > 0:
+		return fmt.Sprintf("%s: %d:%d: %s", e.Stage, e.Line, e.Column, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("%s: %d: %s", e.Stage, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s: %s", e.Stage, e.Message)
+	}
+}
+
+// templateErrorPosition matches the position prefix of text/template errors, e.g. "template: match:3:14: "
+var templateErrorPosition = regexp.MustCompile(`^template: [^:]*:(\d+)(?::(\d+))?: (.*)$`)
+
+// renderMatchTemplate renders the go template with the match info into the json of a match create dto and validates
+// it. All problems found are returned.
+func renderMatchTemplate(templateText string, matchInfo *matchservice.MatchInfo) (json.RawMessage, []TemplateError) {
+	rendered, err := template.ParseTemplateForMatch(templateText, matchInfo)
+	if err != nil {
+		return nil, []TemplateError{renderError(err)}
+	}
+
+	return json.RawMessage(rendered), validateRendered(rendered)
+}
+
+// validateRendered validates the json of a match create dto against the types of the dto and the union members
+func validateRendered(rendered string) []TemplateError {
+	var createMatchDto tmt2_go.IMatchCreateDto
+	if err := json.Unmarshal([]byte(rendered), &createMatchDto); err != nil {
+		return []TemplateError{jsonError(rendered, err)}
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(rendered), &raw); err != nil {
+		return []TemplateError{jsonError(rendered, err)}
+	}
+
+	return ValidateMatchCreateDto(raw)
+}
+
+func renderError(err error) TemplateError {
+	templateError := TemplateError{Stage: StageParse, Message: err.Error()}
+
+	var execError gotemplate.ExecError
+	if errors.As(err, &execError) {
+		templateError.Stage = StageExecute
+	}
+
+	if match := templateErrorPosition.FindStringSubmatch(err.Error()); match != nil {
+		templateError.Line, _ = strconv.Atoi(match[1])
+		templateError.Column, _ = strconv.Atoi(match[2])
+		templateError.Position = PositionTemplate
+		templateError.Message = match[3]
+	}
+
+	return templateError
+}
+
+func jsonError(rendered string, err error) TemplateError {
+	templateError := TemplateError{Stage: StageJSON, Message: err.Error()}
+
+	var offset int64
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		// the offset is behind the invalid character
+		offset = max(syntaxError.Offset-1, 0)
+	case errors.As(err, &typeError):
+		offset = typeError.Offset
+		templateError.Path = typeError.Field
+	default:
+		return templateError
+	}
+
+	before := rendered[:min(int(offset), len(rendered))]
+	lineStart := strings.LastIndex(before, "\n") + 1
+	templateError.Line = strings.Count(before, "\n") + 1
+	templateError.Column = len(before) - lineStart + 1
+	templateError.Position = PositionRendered
+	templateError.Excerpt = excerpt(rendered[lineStart:], len(before)-lineStart)
+	return templateError
+}
+
+// excerptRadius is the number of bytes of the rendered json shown before and after the position of a json error
+const excerptRadius = 40
+
+// excerpt returns the part of the line around the byte offset, rendered templates are often a single long line
+func excerpt(text string, offset int) string {
+	line, _, _ := strings.Cut(text, "\n")
+	line = line[max(0, offset-excerptRadius):min(len(line), offset+excerptRadius)]
+	return strings.TrimSpace(strings.ToValidUTF8(line, ""))
+}
+
+var (
+	whoValues        = []string{string(tmt2_go.TWhoTEAMA), string(tmt2_go.TWhoTEAMB), string(tmt2_go.TWhoTEAMX), string(tmt2_go.TWhoTEAMY)}
+	sideFixedValues  = []string{string(tmt2_go.TEAMACT), string(tmt2_go.TEAMAT), string(tmt2_go.TEAMBCT), string(tmt2_go.TEAMBT), string(tmt2_go.TEAMXCT), string(tmt2_go.TEAMXT), string(tmt2_go.TEAMYCT), string(tmt2_go.TEAMYT)}
+	matchEndActions  = []string{string(tmt2_go.TMatchEndActionKICKALL), string(tmt2_go.TMatchEndActionNONE), string(tmt2_go.TMatchEndActionQUITSERVER)}
+	matchModeValues  = []string{string(tmt2_go.LOOP), string(tmt2_go.SINGLE)}
+	stepMapAddModes  = []string{string(tmt2_go.IFixedMapModeFIXED), string(tmt2_go.IPickMapModePICK), string(tmt2_go.IAgreeOrRandomMapModeAGREE), string(tmt2_go.IAgreeOrRandomMapModeRANDOMPICK)}
+	stepMapSkipModes = []string{string(tmt2_go.BAN), string(tmt2_go.RANDOMBAN)}
+	stepSideModes    = []string{string(tmt2_go.IFixedSideModeFIXED), string(tmt2_go.IPickSideModePICK), string(tmt2_go.IRandomOrKnifeSideModeRANDOM), string(tmt2_go.IRandomOrKnifeSideModeKNIFE)}
+)
+
+// ValidateMatchCreateDto validates the json object of a match create dto. Election steps are checked against the
+// members of the union types, since the generated unions accept any json.
+func ValidateMatchCreateDto(dto map[string]any) []TemplateError {
+	v := &validator{}
+
+	for _, team := range []string{"teamA", "teamB"} {
+		teamObject := v.object(dto, team)
+		if teamObject != nil {
+			v.requiredString(teamObject, team+".name", "name", nil)
+		}
+	}
+
+	mapPool, ok := dto["mapPool"].([]any)
+	if !ok || len(mapPool) == 0 {
+		v.add("mapPool", "is required and must be a non-empty array")
+	}
+	for i, mapName := range mapPool {
+		if name, ok := mapName.(string); !ok || name == "" {
+			v.add(fmt.Sprintf("mapPool[%d]", i), "must be a non-empty string")
+		}
+	}
+
+	if dto["mode"] != nil {
+		v.requiredString(dto, "mode", "mode", matchModeValues)
+	}
+	if dto["matchEndAction"] != nil {
+		v.requiredString(dto, "matchEndAction", "matchEndAction", matchEndActions)
+	}
+
+	electionSteps, ok := dto["electionSteps"].([]any)
+	if !ok || len(electionSteps) == 0 {
+		v.add("electionSteps", "is required and must be a non-empty array")
+	}
+	for i, step := range electionSteps {
+		v.electionStep(fmt.Sprintf("electionSteps[%d]", i), step)
+	}
+
+	return v.errs
+}
+
+type validator struct {
+	errs []TemplateError
+}
+
+func (v *validator) add(path, message string) {
+	v.errs = append(v.errs, TemplateError{Stage: StageValidation, Path: path, Message: message})
+}
+
+func (v *validator) object(parent map[string]any, key string) map[string]any {
+	object, ok := parent[key].(map[string]any)
+	if !ok {
+		v.add(key, "is required and must be an object")
+		return nil
+	}
+	return object
+}
+
+func (v *validator) requiredString(object map[string]any, path, key string, allowed []string) string {
+	value, ok := object[key].(string)
+	switch {
+	case !ok || value == "":
+		v.add(path, "is required and must be a non-empty string")
+	case allowed != nil && !slices.Contains(allowed, value):
+		v.add(path, fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value))
+	}
+	return value
+}
+
+// electionStep validates an election step, which is an IElectionStepAdd with map and side, or an IElectionStepSkip
+// with map only
+func (v *validator) electionStep(path string, step any) {
+	stepObject, ok := step.(map[string]any)
+	if !ok {
+		v.add(path, "must be an object")
+		return
+	}
+
+	mapObject, ok := stepObject["map"].(map[string]any)
+	if !ok {
+		v.add(path+".map", "is required and must be an object")
+		return
+	}
+
+	sideValue, isAdd := stepObject["side"]
+	if !isAdd {
+		v.requiredString(mapObject, path+".map.mode", "mode", stepMapSkipModes)
+		if mapObject["mode"] == string(tmt2_go.BAN) {
+			v.requiredString(mapObject, path+".map.who", "who", whoValues)
+		}
+		return
+	}
+
+	switch v.requiredString(mapObject, path+".map.mode", "mode", stepMapAddModes) {
+	case string(tmt2_go.IFixedMapModeFIXED):
+		v.requiredString(mapObject, path+".map.fixed", "fixed", nil)
+	case string(tmt2_go.IPickMapModePICK):
+		v.requiredString(mapObject, path+".map.who", "who", whoValues)
+	}
+
+	sideObject, ok := sideValue.(map[string]any)
+	if !ok {
+		v.add(path+".side", "must be an object")
+		return
+	}
+
+	switch v.requiredString(sideObject, path+".side.mode", "mode", stepSideModes) {
+	case string(tmt2_go.IFixedSideModeFIXED):
+		v.requiredString(sideObject, path+".side.fixed", "fixed", sideFixedValues)
+	case string(tmt2_go.IPickSideModePICK):
+		v.requiredString(sideObject, path+".side.who", "who", whoValues)
+	}
+}
@@ -0,0 +1,47 @@
+package tmt2
+
+import (
+	"github.com/GSH-LAN/Unwindia_common/src/go/matchservice"
+	"strings"
+	"testing"
+)
+
+func TestTemplateErrorPositions(t *testing.T) {
+	t.Run("json errors point into the rendered json", func(t *testing.T) {
+		errs := validateRendered("{\n  \"teamA\": {\"name\": \"A\"},\n  \"mapPool\": [,]\n}")
+		if len(errs) != 1 {
+			t.Fatalf("expected one error, got %v", errs)
+		}
+		err := errs[0]
+		if err.Stage != StageJSON || err.Position != PositionRendered || err.Line != 3 || err.Column != 15 {
+			t.Fatalf("unexpected json error %+v", err)
+		}
+		if err.Excerpt != `"mapPool": [,]` {
+			t.Fatalf("unexpected excerpt %q", err.Excerpt)
+		}
+		if !strings.Contains(err.Error(), "rendered json 3:15") {
+			t.Fatalf("error %q does not name the rendered json", err.Error())
+		}
+	})
+
+	t.Run("excerpts of long lines are cut around the error", func(t *testing.T) {
+		rendered := `{"mapPool": [` + strings.Repeat(`"de_dust2", `, 20) + `,]}`
+		errs := validateRendered(rendered)
+		if len(errs) != 1 || errs[0].Line != 1 {
+			t.Fatalf("expected one error on the first line, got %v", errs)
+		}
+		if len(errs[0].Excerpt) > 2*excerptRadius || !strings.Contains(errs[0].Excerpt, ",]") {
+			t.Fatalf("unexpected excerpt %q", errs[0].Excerpt)
+		}
+	})
+
+	t.Run("parse errors point into the template", func(t *testing.T) {
+		_, errs := renderMatchTemplate("{\n  \"teamA\": {{ .Team1.Name }\n}", &matchservice.MatchInfo{})
+		if len(errs) != 1 {
+			t.Fatalf("expected one error, got %v", errs)
+		}
+		if err := errs[0]; err.Stage != StageParse || err.Position != PositionTemplate || err.Line != 2 || err.Excerpt != "" {
+			t.Fatalf("unexpected parse error %+v", err)
+		}
+	})
+}